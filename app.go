@@ -4,7 +4,7 @@ import (
 	"context"
 	"fyne.io/systray"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
-	"os"
+	"refi/backend"
 	"refi/icon"
 )
 
@@ -28,23 +28,15 @@ func (a *App) startup(ctx context.Context) {
 }
 
 func (a *App) GetUserDataDir() string {
-	dataDir := os.Getenv("XDG_DATA_HOME")
-	if dataDir == "" {
-		dataDir = os.ExpandEnv("$HOME/.local/share")
-	}
-	return dataDir
+	return backend.UserDataDir()
 }
 
 func (a *App) GetUserConfigDir() string {
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		configDir = os.ExpandEnv("$HOME/.config")
-	}
-	return configDir
+	return backend.UserConfigDir()
 }
 
 func (a *App) GetAppName() string {
-	return "refi"
+	return backend.AppName
 }
 
 func (a *App) sysTrayOnReady() {
@@ -0,0 +1,331 @@
+package annotations
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"path/filepath"
+	"refi/backend/docsets"
+	"refi/backend/statedb"
+	"strings"
+	"time"
+)
+
+// exportVersion is bumped whenever the export format changes incompatibly
+const exportVersion = 1
+
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS annotations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		docSetId TEXT NOT NULL,
+		path TEXT NOT NULL,
+		anchor TEXT NOT NULL DEFAULT '',
+		body TEXT NOT NULL,
+		createdAt INTEGER NOT NULL,
+		updatedAt INTEGER NOT NULL,
+		UNIQUE (docSetId, path, anchor)
+	);`,
+}
+
+// Annotation
+// A private note on a docset page, or on the section of the page starting at `Anchor`. `Body` is Markdown.
+type Annotation struct {
+	Id        int64  `json:"id"`
+	DocSetId  string `json:"docSetId"`
+	Path      string `json:"path"`
+	Anchor    string `json:"anchor"`
+	Body      string `json:"body"`
+	CreatedAt int64  `json:"createdAt"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// Export
+// The JSON document annotations are shared as.
+type Export struct {
+	Version     int          `json:"version"`
+	Annotations []Annotation `json:"annotations"`
+}
+
+type Annotations struct {
+	ctx context.Context
+}
+
+func NewAnnotations() *Annotations {
+	return &Annotations{}
+}
+
+func (a *Annotations) Startup(ctx context.Context) {
+	a.ctx = ctx
+}
+
+type AnnotationResult struct {
+	Annotation Annotation `json:"annotation"`
+	Error      string     `json:"error"`
+}
+
+// SaveAnnotation
+// Creates or replaces the annotation on the page `path` of the docset `docSetId`, at `anchor` (the whole page when
+// empty). `path` may be a `searchIndex` path, when `anchor` is empty any fragment of `path` is used as the anchor.
+func (a *Annotations) SaveAnnotation(docSetId string, path string, anchor string, body string) AnnotationResult {
+	if strings.TrimSpace(body) == "" {
+		message := "SaveAnnotation: Error annotation body is empty"
+		runtime.LogErrorf(a.ctx, message)
+		return AnnotationResult{Error: message}
+	}
+
+	path, anchor = normalisePath(docSetId, path, anchor)
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("SaveAnnotation: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(a.ctx, message)
+		return AnnotationResult{Error: message}
+	}
+
+	now := time.Now().Unix()
+	annotation := Annotation{DocSetId: docSetId, Path: path, Anchor: anchor, Body: body, CreatedAt: now, UpdatedAt: now}
+	err = dbConn.QueryRow(
+		`INSERT INTO annotations (docSetId, path, anchor, body, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (docSetId, path, anchor) DO UPDATE SET body = excluded.body, updatedAt = excluded.updatedAt
+		RETURNING id, createdAt;`,
+		docSetId, path, anchor, body, now, now,
+	).Scan(&annotation.Id, &annotation.CreatedAt)
+	if err != nil {
+		message := fmt.Sprintf("SaveAnnotation: Error saving annotation for \"%s\"\n%s", path, err)
+		runtime.LogErrorf(a.ctx, message)
+		return AnnotationResult{Error: message}
+	}
+
+	return AnnotationResult{Annotation: annotation}
+}
+
+// RemoveAnnotation
+// Deletes the annotation with the id `id`.
+func (a *Annotations) RemoveAnnotation(id int64) string {
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("RemoveAnnotation: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(a.ctx, message)
+		return message
+	}
+
+	result, err := dbConn.Exec("DELETE FROM annotations WHERE id = ?;", id)
+	if err != nil {
+		message := fmt.Sprintf("RemoveAnnotation: Error removing annotation \"%d\"\n%s", id, err)
+		runtime.LogErrorf(a.ctx, message)
+		return message
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		message := fmt.Sprintf("RemoveAnnotation: annotation not found \"%d\"", id)
+		runtime.LogErrorf(a.ctx, message)
+		return message
+	}
+
+	return ""
+}
+
+type ListAnnotationsResult struct {
+	Annotations []Annotation `json:"annotations"`
+	Error       string       `json:"error"`
+}
+
+// ListAnnotations
+// Returns the annotations of the docset `docSetId` (of every docset when empty), ordered by page.
+func (a *Annotations) ListAnnotations(docSetId string) ListAnnotationsResult {
+	annotations, err := queryAnnotations("WHERE ? = '' OR docSetId = ?", docSetId, docSetId)
+	if err != nil {
+		message := fmt.Sprintf("ListAnnotations: Error querying annotations for \"%s\"\n%s", docSetId, err)
+		runtime.LogErrorf(a.ctx, message)
+		return ListAnnotationsResult{Error: message}
+	}
+	return ListAnnotationsResult{Annotations: annotations}
+}
+
+// GetPageAnnotations
+// Returns the annotations on the page `path` of the docset `docSetId`.
+func (a *Annotations) GetPageAnnotations(docSetId string, path string) ListAnnotationsResult {
+	path, _ = normalisePath(docSetId, path, "")
+	annotations, err := ForPage(docSetId, path)
+	if err != nil {
+		message := fmt.Sprintf("GetPageAnnotations: Error querying annotations for \"%s\"\n%s", path, err)
+		runtime.LogErrorf(a.ctx, message)
+		return ListAnnotationsResult{Error: message}
+	}
+	return ListAnnotationsResult{Annotations: annotations}
+}
+
+type ExportAnnotationsResult struct {
+	Data  string `json:"data"`
+	Error string `json:"error"`
+}
+
+// ExportAnnotations
+// Serialises the annotations of the docset `docSetId` (of every docset when empty) as JSON, for `ImportAnnotations`.
+func (a *Annotations) ExportAnnotations(docSetId string) ExportAnnotationsResult {
+	annotations, err := queryAnnotations("WHERE ? = '' OR docSetId = ?", docSetId, docSetId)
+	if err != nil {
+		message := fmt.Sprintf("ExportAnnotations: Error querying annotations for \"%s\"\n%s", docSetId, err)
+		runtime.LogErrorf(a.ctx, message)
+		return ExportAnnotationsResult{Error: message}
+	}
+
+	// ids are local to each state db
+	for index := range annotations {
+		annotations[index].Id = 0
+	}
+	data, err := json.MarshalIndent(Export{Version: exportVersion, Annotations: annotations}, "", "  ")
+	if err != nil {
+		message := fmt.Sprintf("ExportAnnotations: Error encoding annotations\n%s", err)
+		runtime.LogErrorf(a.ctx, message)
+		return ExportAnnotationsResult{Error: message}
+	}
+
+	return ExportAnnotationsResult{Data: string(data)}
+}
+
+type ImportAnnotationsResult struct {
+	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped"`
+	Error    string `json:"error"`
+}
+
+// ImportAnnotations
+// Merges annotations exported by `ExportAnnotations`. When an annotation already exists for the same page and anchor
+// the most recently updated body is kept, so importing is idempotent.
+func (a *Annotations) ImportAnnotations(data string) ImportAnnotationsResult {
+	var export Export
+	err := json.Unmarshal([]byte(data), &export)
+	if err != nil {
+		message := fmt.Sprintf("ImportAnnotations: Error decoding annotations\n%s", err)
+		runtime.LogErrorf(a.ctx, message)
+		return ImportAnnotationsResult{Error: message}
+	}
+	if export.Version > exportVersion {
+		message := fmt.Sprintf("ImportAnnotations: Error unsupported version \"%d\"", export.Version)
+		runtime.LogErrorf(a.ctx, message)
+		return ImportAnnotationsResult{Error: message}
+	}
+
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("ImportAnnotations: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(a.ctx, message)
+		return ImportAnnotationsResult{Error: message}
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		message := fmt.Sprintf("ImportAnnotations: Error starting transaction\n%s", err)
+		runtime.LogErrorf(a.ctx, message)
+		return ImportAnnotationsResult{Error: message}
+	}
+	defer tx.Rollback()
+
+	var result ImportAnnotationsResult
+	now := time.Now().Unix()
+	for _, annotation := range export.Annotations {
+		if annotation.DocSetId == "" || annotation.Path == "" || strings.TrimSpace(annotation.Body) == "" {
+			result.Skipped++
+			continue
+		}
+		if annotation.CreatedAt == 0 {
+			annotation.CreatedAt = now
+		}
+		if annotation.UpdatedAt == 0 {
+			annotation.UpdatedAt = annotation.CreatedAt
+		}
+
+		changes, err := tx.Exec(
+			`INSERT INTO annotations (docSetId, path, anchor, body, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (docSetId, path, anchor) DO UPDATE SET body = excluded.body, updatedAt = excluded.updatedAt
+			WHERE excluded.updatedAt > annotations.updatedAt;`,
+			annotation.DocSetId, annotation.Path, annotation.Anchor, annotation.Body, annotation.CreatedAt,
+			annotation.UpdatedAt,
+		)
+		if err != nil {
+			message := fmt.Sprintf("ImportAnnotations: Error saving annotation for \"%s\"\n%s", annotation.Path, err)
+			runtime.LogErrorf(a.ctx, message)
+			return ImportAnnotationsResult{Error: message}
+		}
+		if changed, _ := changes.RowsAffected(); changed > 0 {
+			result.Imported++
+		} else {
+			result.Skipped++
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		message := fmt.Sprintf("ImportAnnotations: Error committing annotations\n%s", err)
+		runtime.LogErrorf(a.ctx, message)
+		return ImportAnnotationsResult{Error: message}
+	}
+
+	return result
+}
+
+// ForPage
+// Returns the annotations on the page `path` (relative to the docsets `Documents` directory) of the docset
+// `docSetId`, ordered by anchor.
+func ForPage(docSetId string, path string) ([]Annotation, error) {
+	return queryAnnotations("WHERE docSetId = ? AND path = ?", docSetId, filepath.ToSlash(path))
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+func open() (*sql.DB, error) {
+	return statedb.Migrate(migrations...)
+}
+
+func queryAnnotations(where string, args ...interface{}) ([]Annotation, error) {
+	dbConn, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dbConn.Query(
+		"SELECT id, docSetId, path, anchor, body, createdAt, updatedAt FROM annotations "+where+
+			" ORDER BY docSetId, path, anchor;",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	annotations := []Annotation{}
+	for rows.Next() {
+		var annotation Annotation
+		err = rows.Scan(&annotation.Id, &annotation.DocSetId, &annotation.Path, &annotation.Anchor, &annotation.Body,
+			&annotation.CreatedAt, &annotation.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, annotation)
+	}
+	return annotations, rows.Err()
+}
+
+// normalisePath maps `searchIndex` paths of installed docsets to the page relative to the docsets `Documents`
+// directory, so annotations match however the page was reached. Paths of other docsets are kept as is.
+func normalisePath(docSetId string, path string, anchor string) (string, string) {
+	docSet, ok := docsets.Find(docSetId)
+	if !ok {
+		path, fragment, _ := strings.Cut(path, "#")
+		if anchor == "" {
+			anchor = fragment
+		}
+		return path, anchor
+	}
+
+	resolved := docSet.ResolvePath(path)
+	if anchor == "" {
+		anchor = resolved.Fragment
+	}
+	if resolved.RelativePath == "" {
+		return path, anchor
+	}
+	return filepath.ToSlash(resolved.RelativePath), anchor
+}
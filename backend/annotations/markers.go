@@ -0,0 +1,97 @@
+package annotations
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const markerStyle = `<style id="refi-annotations">
+.refi-annotation { margin: 0.5em 0; padding: 0.5em 0.75em; border-left: 3px solid #f0b429; background: rgba(240, 180, 41, 0.12); }
+.refi-annotation-body { white-space: pre-wrap; font: inherit; margin: 0; }
+</style>`
+
+// InjectMarkers
+// Inserts a marker before each annotated section of the html `page`, showing the annotation. Sections start at the
+// element named (or with the id) of the annotations anchor. Page annotations, and those whose anchor can't be found,
+// are shown at the top of the page.
+func InjectMarkers(page []byte, annotations []Annotation) []byte {
+	if len(annotations) == 0 {
+		return page
+	}
+
+	byAnchor := map[string][]Annotation{}
+	for _, annotation := range annotations {
+		byAnchor[annotation.Anchor] = append(byAnchor[annotation.Anchor], annotation)
+	}
+
+	var sections bytes.Buffer
+	injected := map[string]bool{}
+	bodyOffset := -1
+	tokenizer := nethtml.NewTokenizer(bytes.NewReader(page))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == nethtml.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				return page
+			}
+			break
+		}
+		// copied, reading the token lower cases the tag name in place
+		raw := append([]byte(nil), tokenizer.Raw()...)
+
+		if tokenType == nethtml.StartTagToken || tokenType == nethtml.SelfClosingTagToken {
+			token := tokenizer.Token()
+			for _, attr := range token.Attr {
+				if attr.Key != "name" && attr.Key != "id" || attr.Val == "" || injected[attr.Val] {
+					continue
+				}
+				if sectionAnnotations, ok := byAnchor[attr.Val]; ok {
+					injected[attr.Val] = true
+					writeMarkers(&sections, sectionAnnotations)
+				}
+			}
+			sections.Write(raw)
+			if token.DataAtom == atom.Body && bodyOffset < 0 {
+				bodyOffset = sections.Len()
+			}
+			continue
+		}
+		sections.Write(raw)
+	}
+
+	var top bytes.Buffer
+	top.WriteString(markerStyle)
+	for _, annotation := range annotations {
+		if annotation.Anchor == "" || !injected[annotation.Anchor] {
+			writeMarkers(&top, []Annotation{annotation})
+		}
+	}
+
+	annotated := sections.Bytes()
+	if bodyOffset < 0 {
+		// fragments without a body
+		bodyOffset = 0
+	}
+	var result bytes.Buffer
+	result.Grow(len(annotated) + top.Len())
+	result.Write(annotated[:bodyOffset])
+	result.Write(top.Bytes())
+	result.Write(annotated[bodyOffset:])
+	return result.Bytes()
+}
+
+func writeMarkers(buffer *bytes.Buffer, annotations []Annotation) {
+	for _, annotation := range annotations {
+		// Markdown bodies are shown as written, escaped so notes can't inject markup into the page
+		buffer.WriteString(fmt.Sprintf(
+			`<aside class="refi-annotation" data-refi-annotation-id="%d" data-refi-annotation-anchor="%s"><pre class="refi-annotation-body">%s</pre></aside>`,
+			annotation.Id, html.EscapeString(annotation.Anchor), html.EscapeString(strings.TrimSpace(annotation.Body)),
+		))
+	}
+}
@@ -0,0 +1,94 @@
+package annotations
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func marker(id int64, anchor string, body string) string {
+	return fmt.Sprintf(`<aside class="refi-annotation" data-refi-annotation-id="%d" data-refi-annotation-anchor="%s">`+
+		`<pre class="refi-annotation-body">%s</pre></aside>`, id, anchor, body)
+}
+
+func TestInjectMarkers(t *testing.T) {
+	page := `<html><head><title>t</title></head><BODY class="x"><h1>Title</h1>` +
+		`<a name="Foo"></a><p>foo</p><h2 ID="bar">Bar</h2><p>bar</p></body></html>`
+
+	tests := []struct {
+		name        string
+		annotations []Annotation
+		want        string
+	}{
+		{
+			"anchor matched by name",
+			[]Annotation{{Id: 1, Anchor: "Foo", Body: "about foo"}},
+			`<html><head><title>t</title></head><BODY class="x">` + markerStyle + `<h1>Title</h1>` +
+				marker(1, "Foo", "about foo") + `<a name="Foo"></a><p>foo</p><h2 ID="bar">Bar</h2><p>bar</p></body></html>`,
+		},
+		{
+			"anchor matched by id",
+			[]Annotation{{Id: 2, Anchor: "bar", Body: " about bar\n"}},
+			`<html><head><title>t</title></head><BODY class="x">` + markerStyle + `<h1>Title</h1>` +
+				`<a name="Foo"></a><p>foo</p>` + marker(2, "bar", "about bar") + `<h2 ID="bar">Bar</h2><p>bar</p></body></html>`,
+		},
+		{
+			"page annotations and missing anchors at the top",
+			[]Annotation{{Id: 3, Body: "page"}, {Id: 4, Anchor: "gone", Body: "missing"}},
+			`<html><head><title>t</title></head><BODY class="x">` + markerStyle + marker(3, "", "page") +
+				marker(4, "gone", "missing") + `<h1>Title</h1><a name="Foo"></a><p>foo</p><h2 ID="bar">Bar</h2><p>bar</p>` +
+				`</body></html>`,
+		},
+	}
+	for _, test := range tests {
+		if got := string(InjectMarkers([]byte(page), test.annotations)); got != test.want {
+			t.Errorf("%s:\n got %s\nwant %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestInjectMarkersOncePerAnchor(t *testing.T) {
+	page := `<body><a name="x"></a><div id="x"></div></body>`
+	annotations := []Annotation{{Id: 1, Anchor: "x", Body: "a"}, {Id: 2, Anchor: "x", Body: "b"}}
+	got := string(InjectMarkers([]byte(page), annotations))
+	want := `<body>` + markerStyle + marker(1, "x", "a") + marker(2, "x", "b") +
+		`<a name="x"></a><div id="x"></div></body>`
+	if got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestInjectMarkersWithoutBody(t *testing.T) {
+	page := `<p>fragment</p><span id="s">s</span>`
+	got := string(InjectMarkers([]byte(page), []Annotation{{Id: 1, Body: "top"}, {Id: 2, Anchor: "s", Body: "span"}}))
+	want := markerStyle + marker(1, "", "top") + `<p>fragment</p>` + marker(2, "s", "span") + `<span id="s">s</span>`
+	if got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestInjectMarkersEscapes(t *testing.T) {
+	page := `<body><a name="a&quot;b"></a></body>`
+	got := string(InjectMarkers([]byte(page), []Annotation{
+		{Id: 1, Anchor: `a"b`, Body: `<script>alert("x")</script> & **bold**`},
+		{Id: 2, Anchor: `"><img src=x onerror=alert(1)>`, Body: "</pre></aside>"},
+	}))
+
+	if strings.Contains(got, "<script>") || strings.Contains(got, "<img") {
+		t.Errorf("annotation markup wasn't escaped: %s", got)
+	}
+	want := `<body>` + markerStyle +
+		marker(2, "&#34;&gt;&lt;img src=x onerror=alert(1)&gt;", "&lt;/pre&gt;&lt;/aside&gt;") +
+		marker(1, "a&#34;b", "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; **bold**") +
+		`<a name="a&quot;b"></a></body>`
+	if got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestInjectMarkersWithoutAnnotations(t *testing.T) {
+	page := []byte(`<body><p>unchanged</p></body>`)
+	if got := InjectMarkers(page, nil); string(got) != string(page) {
+		t.Errorf("page changed without annotations: %s", got)
+	}
+}
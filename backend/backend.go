@@ -1 +1,40 @@
 package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const AppName = "refi"
+
+func UserDataDir() string {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		dataDir = os.ExpandEnv("$HOME/.local/share")
+	}
+	return dataDir
+}
+
+func UserConfigDir() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		configDir = os.ExpandEnv("$HOME/.config")
+	}
+	return configDir
+}
+
+// AppDataDir
+// Directory Refi stores its own data in, as opposed to data belonging to the docsets.
+func AppDataDir() string {
+	return filepath.Join(UserDataDir(), AppName)
+}
+
+// Quarantine
+// Moves the corrupt file or directory at `path` aside, so it can be rebuilt while the corrupt copy is kept around for
+// inspection. Returns where it was moved to.
+func Quarantine(path string) (string, error) {
+	quarantinePath := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102T150405"))
+	return quarantinePath, os.Rename(path, quarantinePath)
+}
@@ -0,0 +1,390 @@
+package bookmarks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"refi/backend/db"
+	"refi/backend/docsets"
+	"refi/backend/statedb"
+	"sort"
+	"strings"
+	"time"
+)
+
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS bookmarks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		docSetId TEXT NOT NULL,
+		path TEXT NOT NULL,
+		fragment TEXT NOT NULL DEFAULT '',
+		title TEXT NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		type TEXT NOT NULL DEFAULT '',
+		folder TEXT NOT NULL DEFAULT '',
+		createdAt INTEGER NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS bookmarkTags (
+		bookmarkId INTEGER NOT NULL REFERENCES bookmarks (id) ON DELETE CASCADE,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (bookmarkId, tag)
+	);`,
+	`CREATE INDEX IF NOT EXISTS bookmarksDocSetId ON bookmarks (docSetId);`,
+}
+
+// Bookmark
+// A bookmarked docset page or symbol. `Name` and `Type` identify the `searchIndex` entry bookmarked, if any, so the
+// bookmark can be re-resolved when its page moves in a docset update.
+type Bookmark struct {
+	Id        int64    `json:"id"`
+	DocSetId  string   `json:"docSetId"`
+	Path      string   `json:"path"`
+	Fragment  string   `json:"fragment"`
+	Title     string   `json:"title"`
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Folder    string   `json:"folder"`
+	Tags      []string `json:"tags"`
+	CreatedAt int64    `json:"createdAt"`
+	// Missing is set when the page no longer exists and couldn't be re-resolved
+	Missing bool `json:"missing"`
+}
+
+type Bookmarks struct {
+	ctx context.Context
+}
+
+func NewBookmarks() *Bookmarks {
+	return &Bookmarks{}
+}
+
+func (b *Bookmarks) Startup(ctx context.Context) {
+	b.ctx = ctx
+}
+
+type BookmarkResult struct {
+	Bookmark Bookmark `json:"bookmark"`
+	Error    string   `json:"error"`
+}
+
+// AddBookmark
+// Bookmarks a page of an installed docset. `Path` may be a `searchIndex` path, it is stored relative to the docsets
+// `Documents` directory, with any fragment it contains used unless `Fragment` is set.
+func (b *Bookmarks) AddBookmark(bookmark Bookmark) BookmarkResult {
+	docSet, ok := docsets.Find(bookmark.DocSetId)
+	if !ok {
+		message := fmt.Sprintf("AddBookmark: docset not installed \"%s\"", bookmark.DocSetId)
+		runtime.LogErrorf(b.ctx, message)
+		return BookmarkResult{Error: message}
+	}
+
+	resolved := docSet.ResolvePath(bookmark.Path)
+	if !resolved.Exists {
+		message := fmt.Sprintf("AddBookmark: Page not found \"%s\"", bookmark.Path)
+		runtime.LogErrorf(b.ctx, message)
+		return BookmarkResult{Error: message}
+	}
+	bookmark.Path = resolved.RelativePath
+	if bookmark.Fragment == "" {
+		bookmark.Fragment = resolved.Fragment
+	}
+	if strings.TrimSpace(bookmark.Title) == "" {
+		bookmark.Title = bookmark.Name
+		if bookmark.Title == "" {
+			bookmark.Title = bookmark.Path
+		}
+	}
+	bookmark.Folder = normaliseFolder(bookmark.Folder)
+	bookmark.Tags = normaliseTags(bookmark.Tags)
+	bookmark.CreatedAt = time.Now().Unix()
+	bookmark.Missing = false
+
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("AddBookmark: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(b.ctx, message)
+		return BookmarkResult{Error: message}
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		message := fmt.Sprintf("AddBookmark: Error starting transaction\n%s", err)
+		runtime.LogErrorf(b.ctx, message)
+		return BookmarkResult{Error: message}
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO bookmarks (docSetId, path, fragment, title, name, type, folder, createdAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?);",
+		bookmark.DocSetId, bookmark.Path, bookmark.Fragment, bookmark.Title, bookmark.Name, bookmark.Type, bookmark.Folder,
+		bookmark.CreatedAt,
+	)
+	if err == nil {
+		bookmark.Id, err = result.LastInsertId()
+	}
+	for _, tag := range bookmark.Tags {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT INTO bookmarkTags (bookmarkId, tag) VALUES (?, ?);", bookmark.Id, tag)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		message := fmt.Sprintf("AddBookmark: Error saving bookmark \"%s\"\n%s", bookmark.Title, err)
+		runtime.LogErrorf(b.ctx, message)
+		return BookmarkResult{Error: message}
+	}
+
+	return BookmarkResult{Bookmark: bookmark}
+}
+
+// RemoveBookmark
+// Deletes the bookmark with the id `id`.
+func (b *Bookmarks) RemoveBookmark(id int64) string {
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("RemoveBookmark: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(b.ctx, message)
+		return message
+	}
+
+	result, err := dbConn.Exec("DELETE FROM bookmarks WHERE id = ?;", id)
+	if err != nil {
+		message := fmt.Sprintf("RemoveBookmark: Error removing bookmark \"%d\"\n%s", id, err)
+		runtime.LogErrorf(b.ctx, message)
+		return message
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		message := fmt.Sprintf("RemoveBookmark: bookmark not found \"%d\"", id)
+		runtime.LogErrorf(b.ctx, message)
+		return message
+	}
+
+	return ""
+}
+
+type ListBookmarksResult struct {
+	Bookmarks []Bookmark `json:"bookmarks"`
+	Error     string     `json:"error"`
+}
+
+// ListBookmarks
+// Returns the bookmarks of the docset `docSetId` (of every docset when empty), optionally limited to those in
+// `folder` (and its sub folders, folders are `/` separated) and tagged `tag`, ordered by folder then title.
+//
+// Bookmarks whose page disappeared, eg after a docset update, are looked up by symbol name in the docsets
+// `searchIndex` and updated to point at the entries new location. Those that can't be found are flagged `Missing`.
+func (b *Bookmarks) ListBookmarks(docSetId string, folder string, tag string) ListBookmarksResult {
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("ListBookmarks: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(b.ctx, message)
+		return ListBookmarksResult{Error: message}
+	}
+
+	bookmarks, err := queryBookmarks(dbConn, docSetId, normaliseFolder(folder), strings.TrimSpace(tag))
+	if err != nil {
+		message := fmt.Sprintf("ListBookmarks: Error querying bookmarks\n%s", err)
+		runtime.LogErrorf(b.ctx, message)
+		return ListBookmarksResult{Error: message}
+	}
+
+	for index := range bookmarks {
+		b.resolve(dbConn, &bookmarks[index])
+	}
+
+	return ListBookmarksResult{Bookmarks: bookmarks}
+}
+
+type ListFoldersResult struct {
+	Folders []string `json:"folders"`
+	Tags    []string `json:"tags"`
+	Error   string   `json:"error"`
+}
+
+// ListFolders
+// Returns the folders and tags in use by bookmarks of the docset `docSetId`, or of every docset when empty.
+func (b *Bookmarks) ListFolders(docSetId string) ListFoldersResult {
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("ListFolders: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(b.ctx, message)
+		return ListFoldersResult{Error: message}
+	}
+
+	folders, err := queryStrings(dbConn,
+		"SELECT DISTINCT folder FROM bookmarks WHERE folder != '' AND (? = '' OR docSetId = ?) ORDER BY folder;",
+		docSetId, docSetId,
+	)
+	if err != nil {
+		message := fmt.Sprintf("ListFolders: Error querying folders\n%s", err)
+		runtime.LogErrorf(b.ctx, message)
+		return ListFoldersResult{Error: message}
+	}
+
+	tags, err := queryStrings(dbConn,
+		`SELECT DISTINCT bt.tag FROM bookmarkTags bt JOIN bookmarks b ON b.id = bt.bookmarkId
+		WHERE ? = '' OR b.docSetId = ? ORDER BY bt.tag;`,
+		docSetId, docSetId,
+	)
+	if err != nil {
+		message := fmt.Sprintf("ListFolders: Error querying tags\n%s", err)
+		runtime.LogErrorf(b.ctx, message)
+		return ListFoldersResult{Error: message}
+	}
+
+	return ListFoldersResult{Folders: folders, Tags: tags}
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+func open() (*sql.DB, error) {
+	return statedb.Migrate(migrations...)
+}
+
+func queryBookmarks(dbConn *sql.DB, docSetId string, folder string, tag string) ([]Bookmark, error) {
+	rows, err := dbConn.Query(
+		`SELECT b.id, b.docSetId, b.path, b.fragment, b.title, b.name, b.type, b.folder, b.createdAt FROM bookmarks b
+		WHERE (? = '' OR b.docSetId = ?)
+		AND (? = '' OR b.folder = ? OR b.folder LIKE ? ESCAPE '\')
+		AND (? = '' OR EXISTS (SELECT 1 FROM bookmarkTags bt WHERE bt.bookmarkId = b.id AND bt.tag = ?))
+		ORDER BY b.folder, b.title COLLATE NOCASE, b.id;`,
+		docSetId, docSetId, folder, folder, db.EscapeLike(folder)+"/%", tag, tag,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+	for rows.Next() {
+		bookmark := Bookmark{Tags: []string{}}
+		err = rows.Scan(&bookmark.Id, &bookmark.DocSetId, &bookmark.Path, &bookmark.Fragment, &bookmark.Title,
+			&bookmark.Name, &bookmark.Type, &bookmark.Folder, &bookmark.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, bookmark)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for index := range bookmarks {
+		bookmarks[index].Tags, err = queryStrings(dbConn,
+			"SELECT tag FROM bookmarkTags WHERE bookmarkId = ? ORDER BY tag;", bookmarks[index].Id,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bookmarks, nil
+}
+
+func queryStrings(dbConn *sql.DB, sqlQuery string, args ...interface{}) ([]string, error) {
+	rows, err := dbConn.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err = rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// resolve checks the bookmarked page still exists, re-resolving the bookmark by symbol name when it doesn't. Bookmarks
+// of docsets that aren't installed are left alone, they may be installed again later.
+func (b *Bookmarks) resolve(dbConn *sql.DB, bookmark *Bookmark) {
+	docSet, ok := docsets.Find(bookmark.DocSetId)
+	if !ok {
+		return
+	}
+	if docSet.ResolvePath(bookmark.Path).Exists {
+		return
+	}
+
+	bookmark.Missing = true
+	if bookmark.Name == "" {
+		return
+	}
+
+	tokenPath, err := findEntryPath(docSet, bookmark.Name, bookmark.Type)
+	if err != nil {
+		runtime.LogErrorf(b.ctx, "ListBookmarks: Error looking up \"%s\" in \"%s\"\n%s", bookmark.Name, docSet.Id, err)
+		return
+	}
+	if tokenPath == "" {
+		return
+	}
+	resolved := docSet.ResolvePath(tokenPath)
+	if !resolved.Exists {
+		return
+	}
+
+	_, err = dbConn.Exec("UPDATE bookmarks SET path = ?, fragment = ? WHERE id = ?;",
+		resolved.RelativePath, resolved.Fragment, bookmark.Id,
+	)
+	if err != nil {
+		runtime.LogErrorf(b.ctx, "ListBookmarks: Error updating bookmark \"%d\"\n%s", bookmark.Id, err)
+		return
+	}
+	bookmark.Path = resolved.RelativePath
+	bookmark.Fragment = resolved.Fragment
+	bookmark.Missing = false
+}
+
+// findEntryPath returns the `searchIndex` path of the entry named `name`, preferring entries of type `entryType`.
+func findEntryPath(docSet docsets.DocSet, name string, entryType string) (string, error) {
+	dbConn, err := db.OpenSearchIndexDB(docSet.DBPath())
+	if err != nil {
+		return "", err
+	}
+	defer dbConn.Close()
+
+	var tokenPath string
+	err = dbConn.QueryRow(
+		"SELECT si.path FROM searchIndex si WHERE si.name = ? ORDER BY si.type = ? DESC, si.id LIMIT 1;",
+		name, entryType,
+	).Scan(&tokenPath)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return tokenPath, err
+}
+
+// normaliseFolder trims whitespace and stray separators, `" a/ b /"` becomes `"a/b"`.
+func normaliseFolder(folder string) string {
+	var segments []string
+	for _, segment := range strings.Split(folder, "/") {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func normaliseTags(tags []string) []string {
+	seen := map[string]bool{}
+	normalised := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalised = append(normalised, tag)
+	}
+	sort.Strings(normalised)
+	return normalised
+}
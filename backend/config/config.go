@@ -3,15 +3,28 @@ package config
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/fsnotify/fsnotify"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type Config struct {
 	ctx context.Context
+	// updateMu orders updates of the settings, so listeners see the changes in the order they were made
+	updateMu sync.Mutex
+
+	watchMu     sync.Mutex
+	watcher     *fsnotify.Watcher
+	watchedPath string
+	reloadTimer *time.Timer
 }
 
 func NewConfig() *Config {
@@ -22,32 +35,147 @@ func (c *Config) Startup(ctx context.Context) {
 	c.ctx = ctx
 }
 
+// ConfigObject
+// The settings, as stored in the settings file under their `toml` keys. Adding a setting takes a field here, its
+// default in `Defaults` and any checks in `validate`, renaming or moving one takes a migration as well, see
+// `migrations`.
 type ConfigObject struct {
-	DocSetsFeedUrl  string `json:"docSetsFeedUrl"`
-	DocSetsIconsUrl string `json:"docSetsIconsUrl"`
-	DocSetsPath     string `json:"docSetsPath"`
+	// Version is the version of the settings schema the settings file was written with, see `Version`
+	Version         int    `json:"version" toml:"version"`
+	DocSetsFeedUrl  string `json:"docSetsFeedUrl" toml:"docSetsFeedUrl"`
+	DocSetsIconsUrl string `json:"docSetsIconsUrl" toml:"docSetsIconsUrl"`
+	DocSetsPath     string `json:"docSetsPath" toml:"docSetsPath"`
+	// DocSetGroups maps query keywords to the docsets they search, eg `web = ["javascript", "css", "html"]`. Members
+	// can be docset ids or keywords.
+	DocSetGroups map[string][]string `json:"docSetGroups" toml:"docSetGroups"`
+	// DisabledDocSets are the ids of installed docsets left out of global searches
+	DisabledDocSets []string `json:"disabledDocSets" toml:"disabledDocSets"`
+	// SearchEngine is the search backend used for docsets (eg "bleve" or "sqlite"), DocSetSearchEngines overrides it
+	// per docset id
+	SearchEngine        string            `json:"searchEngine" toml:"searchEngine"`
+	DocSetSearchEngines map[string]string `json:"docSetSearchEngines" toml:"docSetSearchEngines"`
+	// Synonyms maps words to other words searched for along with them, eg `len = ["length", "size"]`, on top of the
+	// built-in synonyms for the platform family of each docset
+	Synonyms map[string][]string `json:"synonyms" toml:"synonyms"`
+}
+
+var (
+	current   ConfigObject
+	loaded    bool
+	currentMu sync.RWMutex
+)
+
+// Current
+// Returns the most recently loaded or written settings.
+func Current() ConfigObject {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+
+	return current
 }
 
+// setCurrent replaces the current settings, returning the settings it replaced and whether there were any.
+func setCurrent(config ConfigObject) (ConfigObject, bool) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+
+	previous, wasLoaded := current, loaded
+	current, loaded = config, true
+	return previous, wasLoaded
+}
+
+// LoadSettingsResult
+// Settings that fail validation are reported in `ValidationErrors` and replaced by their defaults, keys that aren't
+// settings (eg typos) are reported in `UnknownKeys` and ignored. `Error` is only set when the file can't be read at
+// all.
 type LoadSettingsResult struct {
-	Config ConfigObject `json:"config"`
-	Error  string       `json:"error"`
+	Config           ConfigObject      `json:"config"`
+	ValidationErrors []ValidationError `json:"validationErrors"`
+	UnknownKeys      []string          `json:"unknownKeys"`
+	// FileVersion is the version the settings file was written with. Files from older versions are migrated as they
+	// are loaded, the file itself is upgraded the next time settings are written.
+	FileVersion int    `json:"fileVersion"`
+	Error       string `json:"error"`
 }
 
+// LoadSettings
+// Reads the settings file at `filePath` over the defaults, migrating it from older versions of the settings schema.
 func (c *Config) LoadSettings(filePath string) LoadSettingsResult {
-	var decoded ConfigObject
-	_, err := toml.DecodeFile(filePath, &decoded)
+	decoded, err := readSettings(filePath)
 	if err != nil {
 		message := fmt.Sprintf("LoadSettings: Error reading file \"%s\"\n%s", filePath, err.Error())
 		runtime.LogErrorf(c.ctx, message)
 		return LoadSettingsResult{Error: message}
 	}
 
-	return LoadSettingsResult{Config: decoded}
+	for _, validationError := range decoded.ValidationErrors {
+		runtime.LogErrorf(c.ctx, "LoadSettings: Invalid setting in \"%s\"\n%s", filePath, validationError)
+	}
+	if len(decoded.UnknownKeys) > 0 {
+		runtime.LogPrintf(c.ctx, "LoadSettings: Unknown keys in \"%s\": %s", filePath, strings.Join(decoded.UnknownKeys, ", "))
+	}
+	if decoded.FileVersion < Version {
+		runtime.LogPrintf(c.ctx, "LoadSettings: Migrated \"%s\" from version %d to %d.", filePath, decoded.FileVersion, Version)
+	}
+
+	c.update(decoded)
+	c.watch(filePath)
+	return LoadSettingsResult{
+		Config:           decoded.Config,
+		ValidationErrors: nonNil(decoded.ValidationErrors),
+		UnknownKeys:      nonNil(decoded.UnknownKeys),
+		FileVersion:      decoded.FileVersion,
+	}
 }
 
+// WriteSettings
+// Settings the frontend doesn't manage (left nil or empty) keep their current value from the settings file. Invalid
+// settings aren't written, the error names the offending keys. Settings files that can't be read, or are from a newer
+// version, are left alone rather than losing the settings in them.
 func (c *Config) WriteSettings(filePath string, config ConfigObject) string {
+	existing, err := readSettings(filePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		message := fmt.Sprintf("WriteSettings: Error reading existing settings \"%s\"\n%s", filePath, err.Error())
+		runtime.LogErrorf(c.ctx, message)
+		return message
+	}
+	if err == nil && existing.FileVersion > Version {
+		message := fmt.Sprintf("WriteSettings: Not overwriting settings from a newer version of Refi (%d) \"%s\"",
+			existing.FileVersion, filePath)
+		runtime.LogErrorf(c.ctx, message)
+		return message
+	}
+	if err == nil {
+		if config.DocSetGroups == nil {
+			config.DocSetGroups = existing.Config.DocSetGroups
+		}
+		if config.DisabledDocSets == nil {
+			config.DisabledDocSets = existing.Config.DisabledDocSets
+		}
+		if config.SearchEngine == "" {
+			config.SearchEngine = existing.Config.SearchEngine
+		}
+		if config.DocSetSearchEngines == nil {
+			config.DocSetSearchEngines = existing.Config.DocSetSearchEngines
+		}
+		if config.Synonyms == nil {
+			config.Synonyms = existing.Config.Synonyms
+		}
+	}
+	config.Version = Version
+
+	if validationErrors := config.validate(); len(validationErrors) > 0 {
+		var problems []string
+		for _, validationError := range validationErrors {
+			problems = append(problems, validationError.Error())
+		}
+		message := fmt.Sprintf("WriteSettings: Invalid settings for \"%s\"\n%s", filePath, strings.Join(problems, "\n"))
+		runtime.LogErrorf(c.ctx, message)
+		return message
+	}
+
 	buffer := new(bytes.Buffer)
-	err := toml.NewEncoder(buffer).Encode(config)
+	err = toml.NewEncoder(buffer).Encode(config)
 	if err != nil {
 		message := fmt.Sprintf("LoadSettings: Error encoding TOML\n%s", err.Error())
 		runtime.LogErrorf(c.ctx, message)
@@ -60,5 +188,14 @@ func (c *Config) WriteSettings(filePath string, config ConfigObject) string {
 		return message
 	}
 
+	c.update(decodedSettings{Config: config, FileVersion: Version})
+	c.watch(filePath)
 	return ""
 }
+
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
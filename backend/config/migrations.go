@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const versionKey = "version"
+
+// migration upgrades settings, as decoded from the settings file, from the version before it
+type migration func(settings map[string]interface{}) error
+
+// migrations upgrade settings files to `Version`, `migrations[n]` upgrades version n to n+1. Settings files without
+// a version predate versioning, they are version 0.
+var migrations = []migration{
+	migrateKeyNames,
+}
+
+// migrate upgrades `settings` to the current version, returning the version they were written with. Settings from a
+// newer version are left as they are, with a `ValidationError` for the version.
+func migrate(settings map[string]interface{}) (int, error) {
+	version := 0
+	for key, value := range settings {
+		if !strings.EqualFold(key, versionKey) {
+			continue
+		}
+		number, ok := value.(int64)
+		if !ok || number < 0 {
+			return Version, ValidationError{Key: versionKey, Message: fmt.Sprintf("version \"%v\" isn't a version number", value)}
+		}
+		version = int(number)
+	}
+	if version > Version {
+		message := fmt.Sprintf("settings are from a newer version of Refi (%d), this version only knows %d", version, Version)
+		return version, ValidationError{Key: versionKey, Message: message}
+	}
+
+	for from := version; from < Version; from++ {
+		if err := migrations[from](settings); err != nil {
+			return version, fmt.Errorf("migrating settings from version %d: %w", from, err)
+		}
+	}
+	settings[versionKey] = int64(Version)
+	return version, nil
+}
+
+// migrateKeyNames renames the keys of version 0 settings, written under the Go field names (`DocSetsFeedUrl`), to
+// their camelCase names.
+func migrateKeyNames(settings map[string]interface{}) error {
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(ConfigObject{})) {
+		key := settingKey(field)
+		for existing, value := range settings {
+			if existing != key && strings.EqualFold(existing, key) {
+				delete(settings, existing)
+				settings[key] = value
+			}
+		}
+	}
+	return nil
+}
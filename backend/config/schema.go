@@ -0,0 +1,252 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+
+	"refi/backend"
+)
+
+// Version is the version of the settings schema. Bump it, and add a migration to `migrations`, whenever settings are
+// renamed, moved or change meaning.
+const Version = 1
+
+// ValidationError
+// A setting that couldn't be used, `Key` is its dotted path in the settings file (eg `docSetGroups.web`). Invalid
+// settings fall back to their defaults.
+type ValidationError struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+var (
+	// searchEngines are the names of the search backends the settings can choose, see `SetSearchEngines`
+	searchEngines   []string
+	searchEnginesMu sync.RWMutex
+)
+
+// SetSearchEngines
+// Registers the names of the available search backends, so settings choosing any other engine are reported. Engines
+// aren't checked until they are registered.
+func SetSearchEngines(names []string) {
+	searchEnginesMu.Lock()
+	defer searchEnginesMu.Unlock()
+
+	searchEngines = slices.Clone(names)
+}
+
+// Defaults
+// Returns the settings used for anything missing from, or invalid in, the settings file.
+func Defaults() ConfigObject {
+	return ConfigObject{
+		Version:         Version,
+		DocSetsFeedUrl:  "https://github.com/Kapeli/feeds/archive/master.zip",
+		DocSetsIconsUrl: "https://raw.githubusercontent.com/christian-schulze/Dash-X-Platform-Resources/master/docset_icons/",
+		DocSetsPath:     filepath.Join(backend.AppDataDir(), "docsets"),
+	}
+}
+
+// decodedSettings
+// Settings read from a settings file, along with what was wrong with it.
+type decodedSettings struct {
+	Config           ConfigObject
+	ValidationErrors []ValidationError
+	UnknownKeys      []string
+	// FileVersion is the version the file was written with, files from older versions are migrated
+	FileVersion int
+}
+
+func readSettings(filePath string) (decodedSettings, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return decodedSettings{}, err
+	}
+	return decodeSettings(string(data))
+}
+
+// decodeSettings decodes the settings in `data` over the defaults, migrating them to the current version first. Keys
+// are decoded one at a time, so a key that doesn't decode, or isn't valid, only loses its own value. Only TOML syntax
+// errors fail the whole file.
+func decodeSettings(data string) (decodedSettings, error) {
+	var raw map[string]interface{}
+	if _, err := toml.Decode(data, &raw); err != nil {
+		return decodedSettings{}, err
+	}
+
+	var decoded decodedSettings
+	failed := map[string]bool{}
+	fileVersion, err := migrate(raw)
+	decoded.FileVersion = fileVersion
+	var validationError ValidationError
+	if errors.As(err, &validationError) {
+		decoded.ValidationErrors = append(decoded.ValidationErrors, validationError)
+		failed[validationError.Key] = true
+	} else if err != nil {
+		return decodedSettings{}, err
+	}
+	// decoded from the file as written when it was up to date, so decoding errors point at the users lines
+	if fileVersion < Version {
+		buffer := new(bytes.Buffer)
+		if err = toml.NewEncoder(buffer).Encode(raw); err != nil {
+			return decodedSettings{}, err
+		}
+		data = buffer.String()
+	}
+
+	var primitives map[string]toml.Primitive
+	metaData, err := toml.Decode(data, &primitives)
+	if err != nil {
+		return decodedSettings{}, err
+	}
+
+	decoded.Config = Defaults()
+	fields := reflect.ValueOf(&decoded.Config).Elem()
+	known := map[string]bool{}
+	for index, field := range reflect.VisibleFields(fields.Type()) {
+		key := settingKey(field)
+		known[key] = true
+		primitive, ok := primitives[key]
+		if !ok || failed[key] {
+			continue
+		}
+		value := reflect.New(field.Type)
+		if err = metaData.PrimitiveDecode(primitive, value.Interface()); err != nil {
+			decoded.ValidationErrors = append(decoded.ValidationErrors, ValidationError{Key: key, Message: err.Error()})
+			failed[key] = true
+			continue
+		}
+		fields.Field(index).Set(value.Elem())
+	}
+	// the version is the one the settings were migrated to
+	decoded.Config.Version = Version
+
+	// unknown keys are reported without the keys within them, keys within settings that failed to decode aren't
+	// unknown
+	for _, key := range metaData.Keys() {
+		if len(key) == 1 && !known[key[0]] {
+			decoded.UnknownKeys = append(decoded.UnknownKeys, key.String())
+		}
+	}
+	for _, key := range metaData.Undecoded() {
+		if len(key) > 1 && known[key[0]] && !failed[key[0]] {
+			decoded.UnknownKeys = append(decoded.UnknownKeys, key.String())
+		}
+	}
+
+	decoded.ValidationErrors = append(decoded.ValidationErrors, decoded.Config.validate()...)
+	return decoded, nil
+}
+
+// validate checks the values of the settings, resetting invalid values to their defaults.
+func (c *ConfigObject) validate() []ValidationError {
+	defaults := Defaults()
+	var validationErrors []ValidationError
+	invalid := func(key string, format string, args ...interface{}) {
+		validationErrors = append(validationErrors, ValidationError{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if err := validateURL(c.DocSetsFeedUrl); err != nil {
+		invalid("docSetsFeedUrl", "%s", err)
+		c.DocSetsFeedUrl = defaults.DocSetsFeedUrl
+	}
+	if err := validateURL(c.DocSetsIconsUrl); err != nil {
+		invalid("docSetsIconsUrl", "%s", err)
+		c.DocSetsIconsUrl = defaults.DocSetsIconsUrl
+	}
+	if err := validateDir(c.DocSetsPath); err != nil {
+		invalid("docSetsPath", "%s", err)
+		c.DocSetsPath = defaults.DocSetsPath
+	}
+
+	for name := range c.DocSetGroups {
+		// group names are typed as query keywords
+		if name == "" || strings.ContainsAny(name, ": \t") {
+			invalid("docSetGroups."+name, "group names can't be empty, or contain spaces or colons")
+			delete(c.DocSetGroups, name)
+		}
+	}
+	if c.SearchEngine != "" {
+		if err := validateSearchEngine(c.SearchEngine); err != nil {
+			invalid("searchEngine", "%s", err)
+			c.SearchEngine = defaults.SearchEngine
+		}
+	}
+	for docSetId, engine := range c.DocSetSearchEngines {
+		if engine == "" {
+			invalid("docSetSearchEngines."+docSetId, "search engine can't be empty")
+			delete(c.DocSetSearchEngines, docSetId)
+		} else if err := validateSearchEngine(engine); err != nil {
+			invalid("docSetSearchEngines."+docSetId, "%s", err)
+			delete(c.DocSetSearchEngines, docSetId)
+		}
+	}
+	for word := range c.Synonyms {
+		// synonyms are looked up by the words of the search term
+		if word == "" || len(strings.Fields(word)) != 1 {
+			invalid("synonyms."+word, "synonyms are for single words")
+			delete(c.Synonyms, word)
+		}
+	}
+
+	return validationErrors
+}
+
+func validateURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("\"%s\" isn't an http or https URL", value)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("\"%s\" has no host", value)
+	}
+	return nil
+}
+
+// validateSearchEngine accepts the registered search engines, or any engine when none are registered.
+func validateSearchEngine(value string) error {
+	searchEnginesMu.RLock()
+	defer searchEnginesMu.RUnlock()
+
+	if len(searchEngines) > 0 && !slices.Contains(searchEngines, value) {
+		return fmt.Errorf("unknown search engine \"%s\", expected one of %s", value, strings.Join(searchEngines, ", "))
+	}
+	return nil
+}
+
+// validateDir accepts absolute paths of directories, or of paths that don't exist yet.
+func validateDir(value string) error {
+	if !filepath.IsAbs(value) {
+		return fmt.Errorf("\"%s\" isn't an absolute path", value)
+	}
+	info, err := os.Stat(value)
+	if err == nil && !info.IsDir() {
+		return fmt.Errorf("\"%s\" isn't a directory", value)
+	}
+	return nil
+}
+
+// settingKey is the key of a setting in the settings file.
+func settingKey(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeVersion0Settings(t *testing.T) {
+	docSetsPath := t.TempDir()
+	decoded, err := decodeSettings(`
+DocSetsFeedUrl = "https://example.com/feed.zip"
+DOCSETSPATH = "` + filepath.ToSlash(docSetsPath) + `"
+`)
+	if err != nil {
+		t.Fatalf("decodeSettings: %s", err)
+	}
+
+	if decoded.FileVersion != 0 || decoded.Config.Version != Version {
+		t.Errorf("versions = %d, %d, want 0, %d", decoded.FileVersion, decoded.Config.Version, Version)
+	}
+	if decoded.Config.DocSetsFeedUrl != "https://example.com/feed.zip" {
+		t.Errorf("DocSetsFeedUrl = %q, not migrated", decoded.Config.DocSetsFeedUrl)
+	}
+	if decoded.Config.DocSetsPath != filepath.ToSlash(docSetsPath) {
+		t.Errorf("DocSetsPath = %q, not migrated", decoded.Config.DocSetsPath)
+	}
+	if decoded.Config.DocSetsIconsUrl != Defaults().DocSetsIconsUrl {
+		t.Errorf("DocSetsIconsUrl = %q, want the default", decoded.Config.DocSetsIconsUrl)
+	}
+	if len(decoded.ValidationErrors) > 0 || len(decoded.UnknownKeys) > 0 {
+		t.Errorf("problems = %v %v, want none", decoded.ValidationErrors, decoded.UnknownKeys)
+	}
+}
+
+func TestDecodeNewerSettings(t *testing.T) {
+	decoded, err := decodeSettings(`
+version = 2
+docSetsFeedUrl = "https://example.com/feed.zip"
+newSetting = true
+`)
+	if err != nil {
+		t.Fatalf("decodeSettings: %s", err)
+	}
+
+	if decoded.FileVersion != 2 {
+		t.Errorf("FileVersion = %d, want 2", decoded.FileVersion)
+	}
+	if len(decoded.ValidationErrors) != 1 || decoded.ValidationErrors[0].Key != versionKey {
+		t.Errorf("ValidationErrors = %v, want one for the version", decoded.ValidationErrors)
+	}
+	// settings this version knows are still used
+	if decoded.Config.DocSetsFeedUrl != "https://example.com/feed.zip" {
+		t.Errorf("DocSetsFeedUrl = %q", decoded.Config.DocSetsFeedUrl)
+	}
+	if !reflect.DeepEqual(decoded.UnknownKeys, []string{"newSetting"}) {
+		t.Errorf("UnknownKeys = %v, want [newSetting]", decoded.UnknownKeys)
+	}
+}
+
+func TestDecodeBadKeyKeepsOthers(t *testing.T) {
+	decoded, err := decodeSettings(`
+version = 1
+docSetsFeedUrl = 5
+searchEngine = "sqlite"
+
+[docSetGroups]
+web = ["css", "html"]
+
+[synonyms.len]
+x = 1
+`)
+	if err != nil {
+		t.Fatalf("decodeSettings: %s", err)
+	}
+
+	var keys []string
+	for _, validationError := range decoded.ValidationErrors {
+		keys = append(keys, validationError.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"docSetsFeedUrl", "synonyms"}) {
+		t.Errorf("ValidationErrors = %v, want docSetsFeedUrl and synonyms", decoded.ValidationErrors)
+	}
+	if decoded.Config.DocSetsFeedUrl != Defaults().DocSetsFeedUrl || decoded.Config.Synonyms != nil {
+		t.Errorf("invalid settings weren't reset, %q %v", decoded.Config.DocSetsFeedUrl, decoded.Config.Synonyms)
+	}
+	if decoded.Config.SearchEngine != "sqlite" {
+		t.Errorf("SearchEngine = %q, lost with the bad keys", decoded.Config.SearchEngine)
+	}
+	if !reflect.DeepEqual(decoded.Config.DocSetGroups, map[string][]string{"web": {"css", "html"}}) {
+		t.Errorf("DocSetGroups = %v, lost with the bad keys", decoded.Config.DocSetGroups)
+	}
+	// keys within settings that failed to decode aren't unknown
+	if len(decoded.UnknownKeys) > 0 {
+		t.Errorf("UnknownKeys = %v, want none", decoded.UnknownKeys)
+	}
+}
+
+func TestDecodeUnknownKeys(t *testing.T) {
+	decoded, err := decodeSettings(`
+version = 1
+typo = 1
+
+[docSetGroups]
+web = ["css"]
+
+[other]
+nested = 1
+
+[other.deeper]
+x = 2
+`)
+	if err != nil {
+		t.Fatalf("decodeSettings: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded.UnknownKeys, []string{"typo", "other"}) {
+		t.Errorf("UnknownKeys = %v, want [typo other]", decoded.UnknownKeys)
+	}
+	if len(decoded.ValidationErrors) > 0 {
+		t.Errorf("ValidationErrors = %v, want none", decoded.ValidationErrors)
+	}
+	if !reflect.DeepEqual(decoded.Config.DocSetGroups, map[string][]string{"web": {"css"}}) {
+		t.Errorf("DocSetGroups = %v", decoded.Config.DocSetGroups)
+	}
+}
+
+func TestDecodeInvalidValuesResetToDefaults(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		settings string
+		key      string
+	}{
+		{`docSetsFeedUrl = "ftp://example.com/feed.zip"`, "docSetsFeedUrl"},
+		{`docSetsFeedUrl = "example.com/feed.zip"`, "docSetsFeedUrl"},
+		{`docSetsIconsUrl = "https://"`, "docSetsIconsUrl"},
+		{`docSetsIconsUrl = "http://[::1"`, "docSetsIconsUrl"},
+		{`docSetsPath = "relative/docsets"`, "docSetsPath"},
+		{`docSetsPath = "` + filepath.ToSlash(file) + `"`, "docSetsPath"},
+	}
+	for _, test := range tests {
+		decoded, err := decodeSettings("version = 1\n" + test.settings + "\n")
+		if err != nil {
+			t.Fatalf("decodeSettings(%q): %s", test.settings, err)
+		}
+		if len(decoded.ValidationErrors) != 1 || decoded.ValidationErrors[0].Key != test.key {
+			t.Errorf("decodeSettings(%q) ValidationErrors = %v, want one for %s", test.settings, decoded.ValidationErrors,
+				test.key)
+		}
+		if !reflect.DeepEqual(decoded.Config, Defaults()) {
+			t.Errorf("decodeSettings(%q) = %+v, want the defaults", test.settings, decoded.Config)
+		}
+	}
+}
+
+func TestDecodeUnknownSearchEngines(t *testing.T) {
+	SetSearchEngines([]string{"bleve", "sqlite"})
+	t.Cleanup(func() { SetSearchEngines(nil) })
+
+	decoded, err := decodeSettings(`
+version = 1
+searchEngine = "lucene"
+
+[docSetSearchEngines]
+go = "sqlite"
+rust = "elastic"
+`)
+	if err != nil {
+		t.Fatalf("decodeSettings: %s", err)
+	}
+
+	var keys []string
+	for _, validationError := range decoded.ValidationErrors {
+		keys = append(keys, validationError.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"searchEngine", "docSetSearchEngines.rust"}) {
+		t.Errorf("ValidationErrors = %v, want searchEngine and docSetSearchEngines.rust", decoded.ValidationErrors)
+	}
+	if decoded.Config.SearchEngine != "" {
+		t.Errorf("SearchEngine = %q, want the default", decoded.Config.SearchEngine)
+	}
+	if !reflect.DeepEqual(decoded.Config.DocSetSearchEngines, map[string]string{"go": "sqlite"}) {
+		t.Errorf("DocSetSearchEngines = %v, want only go", decoded.Config.DocSetSearchEngines)
+	}
+}
+
+func TestDecodeSyntaxError(t *testing.T) {
+	if _, err := decodeSettings("version = 1\ndocSetsFeedUrl =\n"); err == nil {
+		t.Errorf("decodeSettings accepted a syntax error")
+	}
+}
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	changedEventName = "config|changed"
+	// reloadDebounce is how long the settings file has to be left alone before it is reloaded, editors and other Refi
+	// instances write it in several steps
+	reloadDebounce = 250 * time.Millisecond
+)
+
+// Change
+// A setting that changed, `Key` is its dotted path in the settings file. Settings that are tables (eg `synonyms`) are
+// compared entry by entry, a missing entry is nil.
+type Change struct {
+	Key      string      `json:"key"`
+	Previous interface{} `json:"previous"`
+	Current  interface{} `json:"current"`
+}
+
+// ChangedEvent
+// Payload of `config|changed` events, sent whenever the settings change after they were first loaded, whether they
+// were written by Refi or edited by hand.
+type ChangedEvent struct {
+	Config           ConfigObject      `json:"config"`
+	Changes          []Change          `json:"changes"`
+	ValidationErrors []ValidationError `json:"validationErrors"`
+	UnknownKeys      []string          `json:"unknownKeys"`
+}
+
+type changedListener func(previous ConfigObject, current ConfigObject, changes []Change)
+
+var (
+	changedListeners   []changedListener
+	changedListenersMu sync.Mutex
+)
+
+// OnChanged
+// Registers `listener` to be called whenever the settings change after they were first loaded, so services can
+// reconfigure themselves without a restart. Listeners are called one at a time, in the order they were registered,
+// and hold up further updates of the settings until they return, so slow reconfiguring belongs in a goroutine.
+func OnChanged(listener func(previous ConfigObject, current ConfigObject, changes []Change)) {
+	changedListenersMu.Lock()
+	defer changedListenersMu.Unlock()
+
+	changedListeners = append(changedListeners, listener)
+}
+
+// Changed
+// Reports whether `changes` include the setting `key`, or an entry of it.
+func Changed(changes []Change, key string) bool {
+	for _, change := range changes {
+		if change.Key == key || strings.HasPrefix(change.Key, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffSettings
+// Returns the settings that differ between `previous` and `current`. Empty and missing settings are the same.
+func DiffSettings(previous ConfigObject, current ConfigObject) []Change {
+	var changes []Change
+	previousFields := reflect.ValueOf(previous)
+	currentFields := reflect.ValueOf(current)
+	for index, field := range reflect.VisibleFields(previousFields.Type()) {
+		key := settingKey(field)
+		before, after := previousFields.Field(index), currentFields.Field(index)
+		if field.Type.Kind() == reflect.Map {
+			changes = append(changes, diffTable(key, before, after)...)
+			continue
+		}
+		if !equalSetting(before, after) {
+			changes = append(changes, Change{Key: key, Previous: before.Interface(), Current: after.Interface()})
+		}
+	}
+	return changes
+}
+
+// Shutdown
+// Stops watching the settings file.
+func (c *Config) Shutdown(ctx context.Context) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	if c.reloadTimer != nil {
+		c.reloadTimer.Stop()
+	}
+	if c.watcher != nil {
+		if err := c.watcher.Close(); err != nil {
+			runtime.LogErrorf(c.ctx, "Shutdown: Error closing settings watcher\n%s", err)
+		}
+		c.watcher = nil
+		c.watchedPath = ""
+	}
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+// update makes `decoded` the current settings, telling listeners and the frontend what changed. The settings loaded
+// first aren't a change, there was nothing to reconfigure before them.
+func (c *Config) update(decoded decodedSettings) {
+	c.updateMu.Lock()
+	defer c.updateMu.Unlock()
+
+	previous, loaded := setCurrent(decoded.Config)
+	if !loaded {
+		return
+	}
+	changes := DiffSettings(previous, decoded.Config)
+	if len(changes) == 0 {
+		return
+	}
+
+	changedListenersMu.Lock()
+	listeners := append([]changedListener{}, changedListeners...)
+	changedListenersMu.Unlock()
+	for _, listener := range listeners {
+		listener(previous, decoded.Config, changes)
+	}
+
+	runtime.EventsEmit(c.ctx, changedEventName, ChangedEvent{
+		Config:           decoded.Config,
+		Changes:          changes,
+		ValidationErrors: nonNil(decoded.ValidationErrors),
+		UnknownKeys:      nonNil(decoded.UnknownKeys),
+	})
+}
+
+// watch reloads the settings file `filePath` whenever it changes on disk, replacing the file watched before. Its
+// directory is watched rather than the file itself, since editors replace files rather than writing them in place.
+func (c *Config) watch(filePath string) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	filePath = filepath.Clean(filePath)
+	if c.watchedPath == filePath {
+		return
+	}
+
+	if c.watcher == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			runtime.LogErrorf(c.ctx, "watch: Error creating watcher\n%s", err)
+			return
+		}
+		c.watcher = watcher
+		go c.watchEvents(watcher)
+	}
+
+	if c.watchedPath != "" && filepath.Dir(c.watchedPath) != filepath.Dir(filePath) {
+		_ = c.watcher.Remove(filepath.Dir(c.watchedPath))
+	}
+	err := c.watcher.Add(filepath.Dir(filePath))
+	if err != nil {
+		runtime.LogErrorf(c.ctx, "watch: Error watching dir \"%s\"\n%s", filepath.Dir(filePath), err)
+		return
+	}
+	c.watchedPath = filePath
+}
+
+// watchEvents debounces the changes to the settings file, reloading it once they settle.
+func (c *Config) watchEvents(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			c.watchMu.Lock()
+			filePath := c.watchedPath
+			if filepath.Clean(event.Name) == filePath {
+				if c.reloadTimer != nil {
+					c.reloadTimer.Stop()
+				}
+				c.reloadTimer = time.AfterFunc(reloadDebounce, func() {
+					c.reload(filePath)
+				})
+			}
+			c.watchMu.Unlock()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			runtime.LogErrorf(c.ctx, "watchEvents: Error watching settings\n%s", err)
+		}
+	}
+}
+
+// reload reads the settings file again after it changed on disk. A file that can't be read (eg removed, or with a
+// syntax error) leaves the current settings as they are.
+func (c *Config) reload(filePath string) {
+	decoded, err := readSettings(filePath)
+	if err != nil {
+		runtime.LogErrorf(c.ctx, "reload: Error reloading file \"%s\"\n%s", filePath, err)
+		return
+	}
+	for _, validationError := range decoded.ValidationErrors {
+		runtime.LogErrorf(c.ctx, "reload: Invalid setting in \"%s\"\n%s", filePath, validationError)
+	}
+
+	c.update(decoded)
+}
+
+// diffTable compares settings that are tables entry by entry.
+func diffTable(key string, previous reflect.Value, current reflect.Value) []Change {
+	names := map[string]bool{}
+	for _, table := range []reflect.Value{previous, current} {
+		for _, name := range table.MapKeys() {
+			names[name.String()] = true
+		}
+	}
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	var changes []Change
+	for _, name := range sortedNames {
+		before := previous.MapIndex(reflect.ValueOf(name))
+		after := current.MapIndex(reflect.ValueOf(name))
+		if before.IsValid() && after.IsValid() && equalSetting(before, after) {
+			continue
+		}
+		changes = append(changes, Change{Key: key + "." + name, Previous: interfaceOrNil(before), Current: interfaceOrNil(after)})
+	}
+	return changes
+}
+
+func equalSetting(previous reflect.Value, current reflect.Value) bool {
+	switch previous.Kind() {
+	case reflect.Map, reflect.Slice:
+		if previous.Len() == 0 && current.Len() == 0 {
+			return true
+		}
+	}
+	return reflect.DeepEqual(previous.Interface(), current.Interface())
+}
+
+func interfaceOrNil(value reflect.Value) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+	return value.Interface()
+}
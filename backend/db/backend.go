@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"refi/backend/docsearch"
+	"refi/backend/docsets"
+	"refi/backend/query"
+)
+
+// LikeBackend
+// Searches the `searchIndex` table of docsets with SQL LIKE patterns, see `searchDocSetByTypes`. Entries aren't
+// scored, they are ordered by how often and recently they were opened.
+type LikeBackend struct {
+	db *DB
+}
+
+func NewLikeBackend(db *DB) *LikeBackend {
+	return &LikeBackend{db: db}
+}
+
+func (b *LikeBackend) Name() string {
+	return "sqlite"
+}
+
+// Build imports the `searchIndex` table from `Tokens.xml`, for docsets that don't ship one.
+func (b *LikeBackend) Build(docSet docsets.DocSet) error {
+	if b.db.TableExists(docSet.DBPath(), "searchIndex") {
+		return nil
+	}
+	if !fileExists(docSet.TokensXMLPath()) {
+		return errors.New("docset has neither a searchIndex table nor a Tokens.xml to import one from")
+	}
+	if message := b.db.ImportSearchIndex(docSet.DBPath(), docSet.TokensXMLPath()); message != "" {
+		return errors.New(message)
+	}
+	return nil
+}
+
+func (b *LikeBackend) Open(docSet docsets.DocSet) error {
+	_, release, err := b.db.acquireSearchIndex(docSet.DBPath())
+	if err != nil {
+		return err
+	}
+	release()
+	return nil
+}
+
+func (b *LikeBackend) Search(ctx context.Context, docSet docsets.DocSet, searchQuery query.Query, limit int) ([]docsearch.Hit, []query.TypeCount, error) {
+	result := b.db.searchDocSetByTypes(ctx, docSet.DBPath(), searchQuery, limit)
+	if result.Stale {
+		return nil, nil, ctx.Err()
+	}
+	if result.Error != "" {
+		return nil, nil, errors.New(result.Error)
+	}
+
+	hits := make([]docsearch.Hit, 0, len(result.Results))
+	for _, row := range result.Results {
+		hits = append(hits, docsearch.Hit{
+			DocSetId: docSet.Id,
+			Id:       row.Id,
+			Name:     row.Name,
+			Type:     row.Type,
+			Path:     row.Path,
+			Matches:  []docsearch.MatchRange{},
+		})
+	}
+	return hits, result.TypeCounts, nil
+}
+
+func (b *LikeBackend) Close(docSet docsets.DocSet) error {
+	dbPath := docSet.DBPath()
+	err := b.db.connections.Remove(dbPath)
+	if searchIndexPath, ok := b.db.searchIndexPaths.LoadAndDelete(dbPath); ok && searchIndexPath != dbPath {
+		err = errors.Join(err, b.db.connections.Remove(searchIndexPath.(string)))
+	}
+	return err
+}
+
+func (b *LikeBackend) Stats(docSet docsets.DocSet) (docsearch.Stats, error) {
+	stats := docsearch.Stats{Engine: b.Name()}
+
+	searchIndexPath, err := searchIndexDBPath(docSet.DBPath())
+	if err != nil {
+		return stats, err
+	}
+	dbConn, release, err := b.db.acquire(searchIndexPath)
+	if err != nil {
+		return stats, err
+	}
+	defer release()
+
+	var tables int
+	err = dbConn.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name='searchIndex';").Scan(&tables)
+	if err != nil || tables == 0 {
+		return stats, err
+	}
+	stats.Built = true
+	err = dbConn.QueryRow("SELECT count(*) FROM searchIndex;").Scan(&stats.Entries)
+	if err != nil {
+		return stats, err
+	}
+	if info, err := os.Stat(searchIndexPath); err == nil {
+		stats.SizeBytes = info.Size()
+	}
+	return stats, nil
+}
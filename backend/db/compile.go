@@ -0,0 +1,62 @@
+package db
+
+import (
+	"refi/backend/query"
+	"strings"
+)
+
+// likeEscaper escapes the wildcards of LIKE patterns, for patterns with `ESCAPE '\'`
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// EscapeLike
+// Escapes the wildcards in `s`, so it matches literally within LIKE patterns that are used with `ESCAPE '\'`.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// compileQuery compiles the text of `searchQuery` to an SQL condition on the names of `searchIndex si` entries, see
+// `query.Parse`. The term, its expansions and phrases match names containing their words in order, and the operands of
+// operators match literally, any LIKE wildcards typed are escaped. Type filters are left to the caller, since types
+// are counted before filtering. Returns an empty condition when the query has nothing to match.
+func compileQuery(searchQuery query.Query) (string, []interface{}) {
+	if searchQuery.IsEmpty() {
+		return "", nil
+	}
+
+	var conditions []string
+	var args []interface{}
+	if searchQuery.Term != "" {
+		likeCondition := `si.name LIKE ? ESCAPE '\'`
+		conditions = append(conditions, "("+likeCondition+strings.Repeat(" OR "+likeCondition, len(searchQuery.Expansions))+")")
+		args = append(args, containsPattern(searchQuery.Term))
+		for _, expansion := range searchQuery.Expansions {
+			args = append(args, containsPattern(expansion))
+		}
+	}
+	for _, phrase := range searchQuery.Phrases {
+		conditions = append(conditions, `si.name LIKE ? ESCAPE '\'`)
+		args = append(args, containsPattern(phrase))
+	}
+	if searchQuery.Prefix != "" {
+		conditions = append(conditions, `si.name LIKE ? ESCAPE '\'`)
+		args = append(args, EscapeLike(searchQuery.Prefix)+"%")
+	}
+	if searchQuery.Exact != "" {
+		conditions = append(conditions, "si.name = ? COLLATE NOCASE")
+		args = append(args, searchQuery.Exact)
+	}
+	for _, excluded := range searchQuery.Excluded {
+		conditions = append(conditions, `si.name NOT LIKE ? ESCAPE '\'`)
+		args = append(args, containsPattern(excluded))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// containsPattern is a LIKE pattern matching names that contain the words of `phrase` in order.
+func containsPattern(phrase string) string {
+	words := strings.Fields(phrase)
+	for index, word := range words {
+		words[index] = EscapeLike(word)
+	}
+	return "%" + strings.Join(words, "%") + "%"
+}
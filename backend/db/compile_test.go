@@ -0,0 +1,52 @@
+package db
+
+import (
+	"refi/backend/query"
+	"reflect"
+	"testing"
+)
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		input     string
+		condition string
+		args      []interface{}
+	}{
+		{"", "", nil},
+		{"type:func", "", nil},
+		{"http client", `(si.name LIKE ? ESCAPE '\')`, []interface{}{"%http%client%"}},
+		{"100%_done", `(si.name LIKE ? ESCAPE '\')`, []interface{}{`%100\%\_done%`}},
+		{`a\b`, `(si.name LIKE ? ESCAPE '\')`, []interface{}{`%a\\b%`}},
+		{`"http client"`, `si.name LIKE ? ESCAPE '\'`, []interface{}{"%http%client%"}},
+		{"^Json_", `si.name LIKE ? ESCAPE '\'`, []interface{}{`Json\_%`}},
+		{"=String", "si.name = ? COLLATE NOCASE", []interface{}{"String"}},
+		{
+			`x -old -"a%b c"`,
+			`(si.name LIKE ? ESCAPE '\') AND si.name NOT LIKE ? ESCAPE '\' AND si.name NOT LIKE ? ESCAPE '\'`,
+			[]interface{}{"%x%", "%old%", `%a\%b%c%`},
+		},
+		{
+			"type:func Marshal ^json",
+			`(si.name LIKE ? ESCAPE '\') AND si.name LIKE ? ESCAPE '\'`,
+			[]interface{}{"%Marshal%", "json%"},
+		},
+	}
+	for _, test := range tests {
+		condition, args := compileQuery(query.Parse(test.input))
+		if condition != test.condition || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("compileQuery(%q) = %q %q, want %q %q", test.input, condition, args, test.condition, test.args)
+		}
+	}
+}
+
+func TestCompileQueryExpansions(t *testing.T) {
+	searchQuery := query.Parse("map")
+	searchQuery.Expansions = []string{"dict", "hash_map"}
+
+	condition, args := compileQuery(searchQuery)
+	wantCondition := `(si.name LIKE ? ESCAPE '\' OR si.name LIKE ? ESCAPE '\' OR si.name LIKE ? ESCAPE '\')`
+	wantArgs := []interface{}{"%map%", "%dict%", `%hash\_map%`}
+	if condition != wantCondition || !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("compileQuery = %q %q, want %q %q", condition, args, wantCondition, wantArgs)
+	}
+}
@@ -6,15 +6,58 @@ import (
 	"encoding/xml"
 	"fmt"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"net/url"
 	"os"
+	"path/filepath"
+	"refi/backend/docsets"
+	"refi/backend/history"
+	"refi/backend/query"
+	"refi/backend/registry"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+const (
+	// maxOpenConnections is a soft limit, connections that are in use are never evicted
+	maxOpenConnections    = 16
+	connectionIdleTimeout = 5 * time.Minute
+
+	defaultListEntriesLimit = 100
+	maxListEntriesLimit     = 1000
+
+	// boostCandidateSize is how many rows are ranked by frecency, so frequently opened entries just outside the
+	// requested rows can still make it in
+	boostCandidateSize = 50
+)
+
+// ListEntries sort orders
+const (
+	SortByName     = "name"
+	SortByNameDesc = "-name"
+	SortByPath     = "path"
+	SortByPathDesc = "-path"
+)
+
+var listEntriesOrderBy = map[string]string{
+	"":             "si.name COLLATE NOCASE ASC, si.id ASC",
+	SortByName:     "si.name COLLATE NOCASE ASC, si.id ASC",
+	SortByNameDesc: "si.name COLLATE NOCASE DESC, si.id DESC",
+	SortByPath:     "si.path ASC, si.id ASC",
+	SortByPathDesc: "si.path DESC, si.id DESC",
+}
+
 type DB struct {
 	ctx         context.Context
-	connections map[string]*sql.DB
+	connections *registry.Registry[*sql.DB]
+	// searchIndexPaths caches which database holds the `searchIndex` table for a docset database
+	searchIndexPaths sync.Map
+	// installed are the installed docsets by path, as last told by `docsets.OnInstalled`
+	installed   map[string]docsets.DocSet
+	installedMu sync.Mutex
 }
 
 func NewDB() *DB {
@@ -28,47 +71,72 @@ func NewDB() *DB {
 	//		},
 	//	})
 
-	return &DB{connections: map[string]*sql.DB{}}
+	return &DB{connections: registry.New[*sql.DB](maxOpenConnections, connectionIdleTimeout)}
 }
 
 func (db *DB) Startup(ctx context.Context) {
 	db.ctx = ctx
+	docsets.OnInstalled(db.closeDocSetConnections)
+}
+
+func (db *DB) Shutdown(ctx context.Context) {
+	err := db.connections.CloseAll()
+	if err != nil {
+		runtime.LogErrorf(db.ctx, "Shutdown: Error closing connections\n%s", err)
+	}
 }
 
 func (db *DB) OpenDB(dbPath string) string {
-	dbConn, err := sql.Open("sqlite3", dbPath)
-	//db, err := sql.Open("sqlite3_with_spellfix_extension", dbPath)
+	_, release, err := db.acquire(dbPath)
 	if err != nil {
 		runtime.LogErrorf(db.ctx, "OpenDB: Error opening db \"%s\"\n%s", dbPath, err)
 		return err.Error()
 	}
-
-	db.connections[dbPath] = dbConn
+	release()
 
 	return ""
 }
 
 func (db *DB) Close(dbPath string) {
-	dbConn := db.connections[dbPath]
-	if dbConn == nil {
+	if !db.connections.Has(dbPath) {
 		runtime.LogErrorf(db.ctx, "Close: connection not found \"%s\"", dbPath)
 		return
 	}
 
-	err := dbConn.Close()
+	err := db.connections.Remove(dbPath)
 	if err != nil {
 		runtime.LogErrorf(db.ctx, "Close: Error closing db \"%s\"\n%s", dbPath, err)
 	}
 
-	delete(db.connections, dbPath)
+	if searchIndexPath, ok := db.searchIndexPaths.LoadAndDelete(dbPath); ok && searchIndexPath != dbPath {
+		err = db.connections.Remove(searchIndexPath.(string))
+		if err != nil {
+			runtime.LogErrorf(db.ctx, "Close: Error closing db \"%s\"\n%s", searchIndexPath, err)
+		}
+	}
 }
 
+// TableExists
+// Checks both the docset database and, for docset databases, the sidecar database holding the tables Refi generated.
 func (db *DB) TableExists(dbPath string, table string) bool {
-	dbConn := db.connections[dbPath]
-	if dbConn == nil {
-		runtime.LogErrorf(db.ctx, "TableExists: connection not found \"%s\"", dbPath)
+	if db.tableExists(dbPath, table) {
+		return true
+	}
+
+	docSet, err := docsets.FromPath(dbPath)
+	if err != nil || !fileExists(docSet.SidecarDBPath()) {
 		return false
 	}
+	return db.tableExists(docSet.SidecarDBPath(), table)
+}
+
+func (db *DB) tableExists(dbPath string, table string) bool {
+	dbConn, release, err := db.acquire(dbPath)
+	if err != nil {
+		runtime.LogErrorf(db.ctx, "TableExists: Error opening db \"%s\"\n%s", dbPath, err)
+		return false
+	}
+	defer release()
 
 	rows, err := dbConn.Query("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?;", table)
 	if err != nil {
@@ -108,6 +176,9 @@ type Tokens struct {
 	Tokens []Token `xml:"Token"`
 }
 
+// ImportSearchIndex
+// Builds a `searchIndex` table from the docsets `Tokens.xml`, for docsets that don't ship one. The table is written to
+// the docsets sidecar database, leaving the docset database untouched.
 func (db *DB) ImportSearchIndex(dbPath string, xmlFilePath string) string {
 	data, err := os.ReadFile(xmlFilePath)
 	if err != nil {
@@ -124,9 +195,26 @@ func (db *DB) ImportSearchIndex(dbPath string, xmlFilePath string) string {
 		return message
 	}
 
-	dbConn := db.connections[dbPath]
-	if dbConn == nil {
-		message := fmt.Sprintf("ImportSearchIndex: connection not found \"%s\"", dbPath)
+	docSet, err := docsets.FromPath(dbPath)
+	if err != nil {
+		message := fmt.Sprintf("ImportSearchIndex: Error loading docset for \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return message
+	}
+
+	dbConn, release, err := db.acquire(docSet.SidecarDBPath())
+	if err != nil {
+		message := fmt.Sprintf("ImportSearchIndex: Error opening db \"%s\"\n%s", docSet.SidecarDBPath(), err)
+		runtime.LogErrorf(db.ctx, message)
+		return message
+	}
+	defer release()
+	defer db.searchIndexPaths.Delete(dbPath)
+
+	// re-importing replaces the previously imported table
+	_, err = dbConn.Exec("DROP TABLE IF EXISTS searchIndex;")
+	if err != nil {
+		message := fmt.Sprintf("ImportSearchIndex: error dropping searchIndex table\n%s", err)
 		runtime.LogErrorf(db.ctx, message)
 		return message
 	}
@@ -189,22 +277,71 @@ func (d DocSetRows) Keywords(i int) string {
 	return d[i].Name
 }
 
+// SearchDocSetResult
+// Results of searching a single docset, see `LikeBackend`. Searches interrupted before they finished are flagged
+// `Stale`.
 type SearchDocSetResult struct {
-	Results DocSetRows `json:"results"`
-	Error   string     `json:"error"`
+	Results    DocSetRows        `json:"results"`
+	TypeCounts []query.TypeCount `json:"typeCounts"`
+	Stale      bool              `json:"stale"`
+	Error      string            `json:"error"`
 }
 
-func (db *DB) SearchDocSet(dbPath string, term string) SearchDocSetResult {
+// searchDocSetByTypes searches entries whose name matches `searchQuery`, up to `limit` of them. Type counts cover every
+// entry matching the term, regardless of the type filters, so they can be offered as facets.
+func (db *DB) searchDocSetByTypes(ctx context.Context, dbPath string, searchQuery query.Query, limit int) SearchDocSetResult {
 	var docSets = DocSetRows{}
 
-	dbConn := db.connections[dbPath]
-	if dbConn == nil {
-		message := fmt.Sprintf("SearchDocSet: connection not found \"%s\"", dbPath)
+	dbConn, release, err := db.acquireSearchIndex(dbPath)
+	if err != nil {
+		message := fmt.Sprintf("SearchDocSet: Error opening db \"%s\"\n%s", dbPath, err)
 		runtime.LogErrorf(db.ctx, message)
 		return SearchDocSetResult{Results: nil, Error: message}
 	}
+	defer release()
+
+	platformFamily := ""
+	if docSet, err := docsets.FromPath(dbPath); err == nil {
+		platformFamily = docSet.PlatformFamily
+	}
+	searchQuery = searchQuery.WithSynonyms(docsets.Synonyms(platformFamily))
+
+	nameWhere, nameArgs := compileQuery(searchQuery)
+	if nameWhere == "" {
+		return SearchDocSetResult{Results: docSets, TypeCounts: []query.TypeCount{}}
+	}
+
+	typeCounts, err := db.queryTypeCounts(ctx, dbConn, "WHERE "+nameWhere, nameArgs...)
+	if ctx.Err() != nil {
+		return SearchDocSetResult{Stale: true}
+	}
+	if err != nil {
+		message := fmt.Sprintf("SearchDocSet: Error counting types in db \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return SearchDocSetResult{Results: nil, Error: message}
+	}
+
+	sqlQuery := "SELECT si.id, si.name, si.type, si.path FROM searchIndex si WHERE " + nameWhere
+	args := append([]interface{}{}, nameArgs...)
+	if len(searchQuery.Types) > 0 {
+		resolvedTypes := query.ResolveTypes(searchQuery.Types, typeCounts)
+		if len(resolvedTypes) == 0 {
+			return SearchDocSetResult{Results: docSets, TypeCounts: typeCounts}
+		}
+		sqlQuery += " AND si.type IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(resolvedTypes)), ", ") + ")"
+		for _, resolvedType := range resolvedTypes {
+			args = append(args, resolvedType)
+		}
+	}
+	if len(searchQuery.Expansions) > 0 {
+		// entries matching the term as typed come before those only matching a synonym
+		sqlQuery += ` ORDER BY si.name LIKE ? ESCAPE '\' DESC`
+		args = append(args, containsPattern(searchQuery.Term))
+	}
+	sqlQuery += " LIMIT ?;"
+	args = append(args, max(limit, boostCandidateSize))
 
-	stmt, err := dbConn.Prepare("SELECT si.id, si.name, si.type, si.path FROM searchIndex si WHERE si.name LIKE ? LIMIT 100;")
+	stmt, err := dbConn.Prepare(sqlQuery)
 	if err != nil {
 		message := fmt.Sprintf("SearchDocSet: Error preparing query for \"%s\"\n%s", dbPath, err)
 		runtime.LogErrorf(db.ctx, message)
@@ -212,7 +349,10 @@ func (db *DB) SearchDocSet(dbPath string, term string) SearchDocSetResult {
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(term)
+	rows, err := stmt.QueryContext(ctx, args...)
+	if ctx.Err() != nil {
+		return SearchDocSetResult{Stale: true}
+	}
 	if err != nil {
 		message := fmt.Sprintf("SearchDocSet: Error querying db \"%s\"\n%s", dbPath, err)
 		runtime.LogErrorf(db.ctx, message)
@@ -230,12 +370,20 @@ func (db *DB) SearchDocSet(dbPath string, term string) SearchDocSetResult {
 	}
 
 	err = rows.Err()
+	if ctx.Err() != nil {
+		return SearchDocSetResult{Stale: true}
+	}
 	if err != nil {
 		message := fmt.Sprintf("SearchDocSet: Error iterating db row \"%s\"\n%s", dbPath, err)
 		runtime.LogErrorf(db.ctx, message)
 		return SearchDocSetResult{Results: nil, Error: message}
 	}
 
+	db.boostFrequentlyOpened(dbPath, docSets)
+	if len(docSets) > limit {
+		docSets = docSets[:limit]
+	}
+
 	// fuzzy search filtering/ordering
 	//sorter := fuzzy.New(docSets)
 	//sorter.Configure(fuzzy.UnmatchedLetterPenalty(0))
@@ -245,44 +393,379 @@ func (db *DB) SearchDocSet(dbPath string, term string) SearchDocSetResult {
 	//	runtime.LogPrintf(a.ctx, "%+v", result)
 	//}
 
-	return SearchDocSetResult{Results: docSets, Error: ""}
+	return SearchDocSetResult{Results: docSets, TypeCounts: typeCounts, Error: ""}
+}
+
+type ListEntryTypesResult struct {
+	TypeCounts []query.TypeCount `json:"typeCounts"`
+	Error      string            `json:"error"`
+}
+
+// ListEntryTypes
+// Returns every entry type in the docset with the number of entries of that type, most common first.
+func (db *DB) ListEntryTypes(dbPath string) ListEntryTypesResult {
+	dbConn, release, err := db.acquireSearchIndex(dbPath)
+	if err != nil {
+		message := fmt.Sprintf("ListEntryTypes: Error opening db \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return ListEntryTypesResult{Error: message}
+	}
+	defer release()
+
+	typeCounts, err := db.queryTypeCounts(context.Background(), dbConn, "")
+	if err != nil {
+		message := fmt.Sprintf("ListEntryTypes: Error counting types in db \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return ListEntryTypesResult{Error: message}
+	}
+
+	return ListEntryTypesResult{TypeCounts: typeCounts}
+}
+
+type ListEntriesResult struct {
+	Entries DocSetRows `json:"entries"`
+	Total   int        `json:"total"`
+	Error   string     `json:"error"`
+}
+
+// ListEntries
+// Pages through the entries of type `entryType`, ordered by one of the `SortBy*` orders (by name when empty).
+// `Total` is the number of entries of that type, for paging.
+func (db *DB) ListEntries(dbPath string, entryType string, offset int, limit int, sort string) ListEntriesResult {
+	orderBy, ok := listEntriesOrderBy[sort]
+	if !ok {
+		message := fmt.Sprintf("ListEntries: Unknown sort order \"%s\"", sort)
+		runtime.LogErrorf(db.ctx, message)
+		return ListEntriesResult{Error: message}
+	}
+	if limit <= 0 {
+		limit = defaultListEntriesLimit
+	}
+	if limit > maxListEntriesLimit {
+		limit = maxListEntriesLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	dbConn, release, err := db.acquireSearchIndex(dbPath)
+	if err != nil {
+		message := fmt.Sprintf("ListEntries: Error opening db \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return ListEntriesResult{Error: message}
+	}
+	defer release()
+
+	var total int
+	err = dbConn.QueryRow("SELECT count(*) FROM searchIndex si WHERE si.type = ?;", entryType).Scan(&total)
+	if err != nil {
+		message := fmt.Sprintf("ListEntries: Error counting entries in db \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return ListEntriesResult{Error: message}
+	}
+
+	rows, err := dbConn.Query(
+		"SELECT si.id, si.name, si.type, si.path FROM searchIndex si WHERE si.type = ? ORDER BY "+orderBy+" LIMIT ? OFFSET ?;",
+		entryType, limit, offset,
+	)
+	if err != nil {
+		message := fmt.Sprintf("ListEntries: Error querying db \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return ListEntriesResult{Error: message}
+	}
+	defer rows.Close()
+
+	entries := DocSetRows{}
+	for rows.Next() {
+		var entry = DocSetRow{}
+		err = rows.Scan(&entry.Id, &entry.Name, &entry.Type, &entry.Path)
+		if err != nil {
+			runtime.LogErrorf(db.ctx, "ListEntries: Error scanning db row \"%s\"\n%s", dbPath, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		message := fmt.Sprintf("ListEntries: Error iterating db row \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return ListEntriesResult{Error: message}
+	}
+
+	return ListEntriesResult{Entries: entries, Total: total}
 }
 
+// CreateFuzzySearchIndex
+// Builds a spellfix1 table of the `searchIndex` names in the docsets sidecar database, along with a table mapping
+// `searchIndex` rows to their spellfix1 word.
 func (db *DB) CreateFuzzySearchIndex(dbPath string) string {
-	dbConn := db.connections[dbPath]
-	if dbConn == nil {
-		message := fmt.Sprintf("CreateFuzzySearchIndex: connection not found \"%s\"", dbPath)
+	docSet, err := docsets.FromPath(dbPath)
+	if err != nil {
+		message := fmt.Sprintf("CreateFuzzySearchIndex: Error loading docset for \"%s\"\n%s", dbPath, err)
 		runtime.LogErrorf(db.ctx, message)
 		return message
 	}
 
-	_, err := dbConn.Exec("CREATE VIRTUAL TABLE fuzzySearchIndex USING spellfix1();")
+	searchConn, releaseSearch, err := db.acquireSearchIndex(dbPath)
+	if err != nil {
+		message := fmt.Sprintf("CreateFuzzySearchIndex: Error opening db \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return message
+	}
+	defer releaseSearch()
+
+	sidecarConn, releaseSidecar, err := db.acquire(docSet.SidecarDBPath())
+	if err != nil {
+		message := fmt.Sprintf("CreateFuzzySearchIndex: Error opening db \"%s\"\n%s", docSet.SidecarDBPath(), err)
+		runtime.LogErrorf(db.ctx, message)
+		return message
+	}
+	defer releaseSidecar()
+
+	_, err = sidecarConn.Exec("CREATE VIRTUAL TABLE fuzzySearchIndex USING spellfix1();")
 	if err != nil {
 		message := fmt.Sprintf("CreateFuzzySearchIndex: error creating fuzzySearchIndex table\n%s", err)
 		runtime.LogErrorf(db.ctx, message)
 		return message
 	}
 
-	_, err = dbConn.Exec("INSERT INTO fuzzySearchIndex(word) SELECT si.name FROM searchIndex si;")
+	_, err = sidecarConn.Exec("CREATE TABLE searchIndexFuzzySearchIndex(searchIndexId INTEGER PRIMARY KEY, fuzzySearchIndexId INTEGER REFERENCES fuzzySearchIndex (rowid));")
 	if err != nil {
-		message := fmt.Sprintf("CreateFuzzySearchIndex: error populating fuzzySearchIndex table\n%s", err)
+		message := fmt.Sprintf("CreateFuzzySearchIndex: error creating searchIndexFuzzySearchIndex table\n%s", err)
 		runtime.LogErrorf(db.ctx, message)
 		return message
 	}
 
-	_, err = dbConn.Exec("ALTER TABLE searchIndex ADD fuzzySearchIndexId INTEGER REFERENCES fuzzySearchIndex (rowid);")
+	rows, err := searchConn.Query("SELECT si.id, si.name FROM searchIndex si;")
+	if err != nil {
+		message := fmt.Sprintf("CreateFuzzySearchIndex: Error querying db \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return message
+	}
+	defer rows.Close()
+
+	tx, err := sidecarConn.Begin()
+	if err != nil {
+		message := fmt.Sprintf("CreateFuzzySearchIndex: error starting transaction\n%s", err)
+		runtime.LogErrorf(db.ctx, message)
+		return message
+	}
+	defer tx.Rollback()
+
+	for rows.Next() {
+		var id int32
+		var name string
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			runtime.LogErrorf(db.ctx, "CreateFuzzySearchIndex: Error scanning db row \"%s\"\n%s", dbPath, err)
+			continue
+		}
+
+		result, err := tx.Exec("INSERT INTO fuzzySearchIndex(word) VALUES (?);", name)
+		if err != nil {
+			message := fmt.Sprintf("CreateFuzzySearchIndex: error populating fuzzySearchIndex table\n%s", err)
+			runtime.LogErrorf(db.ctx, message)
+			return message
+		}
+		fuzzySearchIndexId, err := result.LastInsertId()
+		if err != nil {
+			message := fmt.Sprintf("CreateFuzzySearchIndex: error reading fuzzySearchIndex rowid\n%s", err)
+			runtime.LogErrorf(db.ctx, message)
+			return message
+		}
+
+		_, err = tx.Exec("INSERT INTO searchIndexFuzzySearchIndex(searchIndexId, fuzzySearchIndexId) VALUES (?, ?);", id, fuzzySearchIndexId)
+		if err != nil {
+			message := fmt.Sprintf("CreateFuzzySearchIndex: error populating searchIndexFuzzySearchIndex table\n%s", err)
+			runtime.LogErrorf(db.ctx, message)
+			return message
+		}
+	}
+
+	err = rows.Err()
 	if err != nil {
-		message := fmt.Sprintf("CreateFuzzySearchIndex: error altering searchIndex table\n%s", err)
+		message := fmt.Sprintf("CreateFuzzySearchIndex: Error iterating db row \"%s\"\n%s", dbPath, err)
 		runtime.LogErrorf(db.ctx, message)
 		return message
 	}
 
-	_, err = dbConn.Exec("UPDATE searchIndex SET fuzzySearchIndexId = fsi.rowid FROM fuzzySearchIndex fsi WHERE name = fsi.word;")
+	err = tx.Commit()
 	if err != nil {
-		message := fmt.Sprintf("CreateFuzzySearchIndex: error populating searchIndex table with foreign keys\n%s", err)
+		message := fmt.Sprintf("CreateFuzzySearchIndex: error committing transaction\n%s", err)
 		runtime.LogErrorf(db.ctx, message)
 		return message
 	}
 
 	return ""
 }
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+// boostFrequentlyOpened moves the entries opened most often and most recently to the top, keeping the order of the
+// rest.
+func (db *DB) boostFrequentlyOpened(dbPath string, rows DocSetRows) {
+	docSet, err := docsets.FromPath(dbPath)
+	if err != nil {
+		return
+	}
+	frecency, err := history.Frecency(docSet.Id)
+	if err != nil {
+		runtime.LogErrorf(db.ctx, "SearchDocSet: Error loading history for \"%s\"\n%s", docSet.Id, err)
+		return
+	}
+
+	sort.SliceStable(rows, func(a, b int) bool {
+		return frecency(rows[a].Name, rows[a].Type) > frecency(rows[b].Name, rows[b].Type)
+	})
+}
+
+// queryTypeCounts counts the `searchIndex` rows per type, `where` restricts the rows counted.
+func (db *DB) queryTypeCounts(ctx context.Context, dbConn *sql.DB, where string, args ...interface{}) ([]query.TypeCount, error) {
+	rows, err := dbConn.QueryContext(ctx, "SELECT IFNULL(si.type, ''), count(*) FROM searchIndex si "+where+" GROUP BY si.type;", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	typeCounts := []query.TypeCount{}
+	for rows.Next() {
+		var typeCount query.TypeCount
+		err = rows.Scan(&typeCount.Type, &typeCount.Count)
+		if err != nil {
+			return nil, err
+		}
+		typeCounts = append(typeCounts, typeCount)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query.SortTypeCounts(typeCounts)
+	return typeCounts, nil
+}
+
+// OpenDocSetDB
+// Opens a docset database read-only, docsets may live on read-only or shared storage and are never modified.
+func OpenDocSetDB(dbPath string) (*sql.DB, error) {
+	dsn := (&url.URL{Scheme: "file", Path: dbPath, RawQuery: "mode=ro&immutable=1"}).String()
+	return sql.Open("sqlite3", dsn)
+}
+
+// OpenSearchIndexDB
+// Opens the database holding the `searchIndex` table for the docset database `dbPath`. This is the docset database
+// itself, unless the docset shipped without the table and it was imported into the sidecar database instead.
+func OpenSearchIndexDB(dbPath string) (*sql.DB, error) {
+	searchIndexPath, err := searchIndexDBPath(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return openDB(searchIndexPath)
+}
+
+// acquire returns the registered connection for `dbPath`, (re)opening it if it was never opened or has since been
+// evicted. The returned release function must be called once the caller is done with the connection.
+func (db *DB) acquire(dbPath string) (*sql.DB, registry.ReleaseFunc, error) {
+	return db.connections.Acquire(dbPath, func() (*sql.DB, error) {
+		return openDB(dbPath)
+	})
+}
+
+// acquireSearchIndex is `acquire` for the database holding the `searchIndex` table of the docset database `dbPath`.
+func (db *DB) acquireSearchIndex(dbPath string) (*sql.DB, registry.ReleaseFunc, error) {
+	searchIndexPath, ok := db.searchIndexPaths.Load(dbPath)
+	if !ok {
+		path, err := searchIndexDBPath(dbPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		searchIndexPath, _ = db.searchIndexPaths.LoadOrStore(dbPath, path)
+	}
+	return db.acquire(searchIndexPath.(string))
+}
+
+// closeDocSetConnections closes the connections to files within docsets that were reinstalled, updated or removed.
+// They are opened immutable, so SQLite won't notice a docset being replaced by an update, and would read stale pages.
+// Connections to docsets that didn't change are left open, and connections still in use are closed once they are
+// released.
+func (db *DB) closeDocSetConnections(installed []docsets.DocSet) {
+	current := map[string]docsets.DocSet{}
+	for _, docSet := range installed {
+		current[docSet.Path] = docSet
+	}
+	db.installedMu.Lock()
+	previous := db.installed
+	db.installed = current
+	db.installedMu.Unlock()
+
+	changed := func(dbPath string) bool {
+		rootPath, ok := docsets.RootPath(dbPath)
+		if !ok {
+			return false
+		}
+		docSet, wasInstalled := previous[rootPath]
+		return !wasInstalled || docSet != current[rootPath]
+	}
+
+	for _, dbPath := range db.connections.Keys() {
+		if !changed(dbPath) {
+			continue
+		}
+		err := db.connections.Remove(dbPath)
+		if err != nil {
+			runtime.LogErrorf(db.ctx, "closeDocSetConnections: Error closing db \"%s\"\n%s", dbPath, err)
+		}
+	}
+	// an updated docset may ship the searchIndex table it was missing, or drop it
+	db.searchIndexPaths.Range(func(dbPath, searchIndexPath interface{}) bool {
+		if changed(dbPath.(string)) {
+			db.searchIndexPaths.Delete(dbPath)
+		}
+		return true
+	})
+}
+
+// openDB opens files within a docset read-only, anything else (sidecar databases) is opened read-write and created
+// if needed.
+func openDB(dbPath string) (*sql.DB, error) {
+	if _, ok := docsets.RootPath(dbPath); ok {
+		return OpenDocSetDB(dbPath)
+	}
+
+	err := os.MkdirAll(filepath.Dir(dbPath), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open("sqlite3", dbPath)
+	//return sql.Open("sqlite3_with_spellfix_extension", dbPath)
+}
+
+func searchIndexDBPath(dbPath string) (string, error) {
+	dbConn, err := openDB(dbPath)
+	if err != nil {
+		return "", err
+	}
+	defer dbConn.Close()
+
+	var count int
+	err = dbConn.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name='searchIndex';").Scan(&count)
+	if err != nil {
+		return "", err
+	}
+	if count == 1 {
+		return dbPath, nil
+	}
+
+	docSet, err := docsets.FromPath(dbPath)
+	if err != nil || !fileExists(docSet.SidecarDBPath()) {
+		// nothing imported yet, queries will report the missing table
+		return dbPath, nil
+	}
+	return docSet.SidecarDBPath(), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"refi/backend/docsets"
+	"strings"
+)
+
+type OutlineEntry struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Fragment string `json:"fragment"`
+	// EntryId is the id of the `searchIndex` row pointing at the symbol, 0 when the page is the only place it appears
+	EntryId int32 `json:"entryId"`
+}
+
+type GetPageOutlineResult struct {
+	// Path is the page relative to the docsets `Documents` directory
+	Path    string         `json:"path"`
+	Entries []OutlineEntry `json:"entries"`
+	Error   string         `json:"error"`
+}
+
+// GetPageOutline
+// Lists the symbols defined on a page, in the order they appear, for a table of contents. Symbols come from the Dash
+// anchors in the page, combined with the `searchIndex` entries pointing into it (entries whose anchor isn't found in
+// the page are listed last). `docSet` is the id of an installed docset or a path within it, `pagePath` is a
+// `searchIndex` path.
+func (db *DB) GetPageOutline(docSet string, pagePath string) GetPageOutlineResult {
+	ds, err := docsets.Lookup(docSet)
+	if err != nil {
+		message := fmt.Sprintf("GetPageOutline: Error loading docset \"%s\"\n%s", docSet, err)
+		runtime.LogErrorf(db.ctx, message)
+		return GetPageOutlineResult{Error: message}
+	}
+
+	page := ds.ResolvePath(pagePath)
+	if !page.Exists {
+		message := fmt.Sprintf("GetPageOutline: Page not found \"%s\"", pagePath)
+		runtime.LogErrorf(db.ctx, message)
+		return GetPageOutlineResult{Error: message}
+	}
+
+	anchors, err := docsets.ReadPageAnchors(page.DocumentPath)
+	if err != nil {
+		message := fmt.Sprintf("GetPageOutline: Error reading page \"%s\"\n%s", page.DocumentPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return GetPageOutlineResult{Error: message}
+	}
+
+	entries := make([]OutlineEntry, 0, len(anchors))
+	fragmentIndexes := map[string]int{}
+	for _, anchor := range anchors {
+		fragmentIndexes[anchor.Fragment] = len(entries)
+		entries = append(entries, OutlineEntry{Name: anchor.Name, Type: anchor.Type, Fragment: anchor.Fragment})
+	}
+
+	rows, err := db.pageEntries(ds, page)
+	if err != nil {
+		message := fmt.Sprintf("GetPageOutline: Error querying entries for \"%s\"\n%s", page.RelativePath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return GetPageOutlineResult{Error: message}
+	}
+
+	for _, row := range rows {
+		_, fragment := splitTokenPath(row.Path)
+		if index, ok := fragmentIndexes[fragment]; ok && fragment != "" {
+			// prefer the names and types of the index, anchors are often mangled
+			if entries[index].EntryId == 0 {
+				entries[index].Name = row.Name
+				entries[index].Type = row.Type
+				entries[index].EntryId = row.Id
+			}
+			continue
+		}
+		entries = append(entries, OutlineEntry{Name: row.Name, Type: row.Type, Fragment: fragment, EntryId: row.Id})
+	}
+
+	return GetPageOutlineResult{Path: page.RelativePath, Entries: entries}
+}
+
+// pageEntries returns the `searchIndex` rows pointing into `page`, in index order.
+func (db *DB) pageEntries(ds docsets.DocSet, page docsets.ResolvedPath) (DocSetRows, error) {
+	dbConn, release, err := db.acquireSearchIndex(ds.DBPath())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// paths may be prefixed with metadata, url encoded, or carry a fragment or query
+	var conditions []string
+	var args []interface{}
+	for _, pagePath := range pageTokenPaths(page.RelativePath) {
+		escaped := EscapeLike(pagePath)
+		conditions = append(conditions,
+			`si.path = ?`,
+			`si.path LIKE ? ESCAPE '\'`,
+			`si.path LIKE ? ESCAPE '\'`,
+			`si.path LIKE ? ESCAPE '\'`,
+			`si.path LIKE ? ESCAPE '\'`,
+		)
+		args = append(args, pagePath, escaped+"#%", escaped+"?%", `<dash\_entry\_%>`+escaped, `<dash\_entry\_%>`+escaped+"#%")
+	}
+	rows, err := dbConn.Query(
+		"SELECT si.id, si.name, si.type, si.path FROM searchIndex si WHERE "+strings.Join(conditions, " OR ")+" ORDER BY si.id;",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	relativePath := filepath.ToSlash(page.RelativePath)
+	entries := DocSetRows{}
+	for rows.Next() {
+		var entry = DocSetRow{}
+		err = rows.Scan(&entry.Id, &entry.Name, &entry.Type, &entry.Path)
+		if err != nil {
+			return nil, err
+		}
+		if tokenPagePath, _ := splitTokenPath(entry.Path); pointsAtPage(tokenPagePath, relativePath) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, rows.Err()
+}
+
+// pageTokenPaths lists the ways `searchIndex` paths can refer to the page `relativePath`, as written and url encoded,
+// and as their directory for `index.html` pages.
+func pageTokenPaths(relativePath string) []string {
+	relativePath = filepath.ToSlash(relativePath)
+	pagePaths := []string{relativePath}
+	if path.Base(relativePath) == "index.html" && path.Dir(relativePath) != "." {
+		pagePaths = append(pagePaths, path.Dir(relativePath), path.Dir(relativePath)+"/")
+	}
+
+	var tokenPaths []string
+	for _, pagePath := range pagePaths {
+		tokenPaths = append(tokenPaths, pagePath, "/"+pagePath)
+		if escaped := (&url.URL{Path: pagePath}).EscapedPath(); escaped != pagePath {
+			tokenPaths = append(tokenPaths, escaped, "/"+escaped)
+		}
+	}
+	return tokenPaths
+}
+
+// splitTokenPath splits a `searchIndex` path into the page it points at, relative to the `Documents` directory, and
+// its fragment. It's `ResolvePath` without looking at the docset, for comparing paths.
+func splitTokenPath(tokenPath string) (string, string) {
+	tokenPath = docsets.StripDashEntryMetadata(tokenPath)
+	rawPath, fragment, _ := strings.Cut(tokenPath, "#")
+	rawPath, _, _ = strings.Cut(rawPath, "?")
+	rawPath = strings.TrimPrefix(rawPath, "/")
+	if decodedPath, err := url.PathUnescape(rawPath); err == nil {
+		rawPath = decodedPath
+	}
+	return rawPath, fragment
+}
+
+// pointsAtPage reports whether the page of a `searchIndex` path is `relativePath`, directories point at their
+// `index.html`.
+func pointsAtPage(tokenPagePath string, relativePath string) bool {
+	if tokenPagePath == relativePath {
+		return true
+	}
+	return path.Base(relativePath) == "index.html" && path.Dir(relativePath) != "." &&
+		strings.TrimSuffix(tokenPagePath, "/") == path.Dir(relativePath)
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"refi/backend"
+	"refi/backend/docsets"
+	"strings"
+)
+
+// CheckDB
+// Runs SQLite's quick integrity check against the database at `dbPath`, returning the problems found.
+func (db *DB) CheckDB(dbPath string) string {
+	dbConn, err := openDB(dbPath)
+	if err != nil {
+		message := fmt.Sprintf("CheckDB: Error opening db \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return message
+	}
+	defer dbConn.Close()
+
+	rows, err := dbConn.Query("PRAGMA quick_check;")
+	if err != nil {
+		message := fmt.Sprintf("CheckDB: Error checking db \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return message
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var problem string
+		err = rows.Scan(&problem)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if problem != "ok" {
+			problems = append(problems, problem)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		message := fmt.Sprintf("CheckDB: db is corrupt \"%s\"\n%s", dbPath, strings.Join(problems, "\n"))
+		runtime.LogErrorf(db.ctx, message)
+		return message
+	}
+	return ""
+}
+
+type QuarantineSidecarDBResult struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// QuarantineSidecarDB
+// Closes the corrupt sidecar database of the docset database `dbPath` and moves it aside, so the tables Refi generated
+// can be rebuilt. `Path` is where it was moved to.
+func (db *DB) QuarantineSidecarDB(dbPath string) QuarantineSidecarDBResult {
+	docSet, err := docsets.FromPath(dbPath)
+	if err != nil {
+		message := fmt.Sprintf("QuarantineSidecarDB: Error loading docset for \"%s\"\n%s", dbPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return QuarantineSidecarDBResult{Error: message}
+	}
+
+	sidecarDBPath := docSet.SidecarDBPath()
+	db.searchIndexPaths.Delete(dbPath)
+	err = db.connections.Remove(sidecarDBPath)
+	if err != nil {
+		runtime.LogErrorf(db.ctx, "QuarantineSidecarDB: Error closing db \"%s\"\n%s", sidecarDBPath, err)
+	}
+
+	quarantinePath, err := backend.Quarantine(sidecarDBPath)
+	if err != nil {
+		message := fmt.Sprintf("QuarantineSidecarDB: Error moving db \"%s\"\n%s", sidecarDBPath, err)
+		runtime.LogErrorf(db.ctx, message)
+		return QuarantineSidecarDBResult{Error: message}
+	}
+	// the journal belongs to the corrupt database, it mustn't be replayed into the new one
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if fileExists(sidecarDBPath + suffix) {
+			_, _ = backend.Quarantine(sidecarDBPath + suffix)
+		}
+	}
+
+	runtime.LogPrintf(db.ctx, "QuarantineSidecarDB: moved \"%s\" to \"%s\".", sidecarDBPath, quarantinePath)
+	return QuarantineSidecarDBResult{Path: quarantinePath}
+}
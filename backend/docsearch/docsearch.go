@@ -0,0 +1,308 @@
+package docsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"refi/backend/config"
+	"refi/backend/docsets"
+	"refi/backend/inflight"
+	"refi/backend/query"
+	"sort"
+)
+
+const (
+	// DefaultEngine searches docsets unless the settings choose another engine
+	DefaultEngine = "bleve"
+
+	defaultSearchLimit = 10
+	maxSearchLimit     = 1000
+)
+
+// Backend
+// A search engine for the entries of docsets. Backends are plugged in with `NewSearch`, and chosen globally or per
+// docset with the `searchEngine` and `docSetSearchEngines` settings.
+type Backend interface {
+	// Name identifies the backend in the settings
+	Name() string
+	// Build creates, or recreates, whatever the backend searches for `docSet`
+	Build(docSet docsets.DocSet) error
+	// Open gets the backend ready to search `docSet`, failing when it hasn't been built
+	Open(docSet docsets.DocSet) error
+	// Search returns up to `limit` entries of `docSet` matching `searchQuery`, along with the number of matching
+	// entries per type, regardless of type filters. Stops early once `ctx` is cancelled.
+	Search(ctx context.Context, docSet docsets.DocSet, searchQuery query.Query, limit int) ([]Hit, []query.TypeCount, error)
+	// Close releases anything the backend holds open for `docSet`
+	Close(docSet docsets.DocSet) error
+	Stats(docSet docsets.DocSet) (Stats, error)
+}
+
+// Hit
+// A docset entry found by a backend. Backends that don't score or highlight matches leave `Score`, `Matches` and
+// `Clause` empty.
+type Hit struct {
+	DocSetId string       `json:"docSetId"`
+	Id       int32        `json:"id"`
+	Name     string       `json:"name"`
+	Type     string       `json:"type"`
+	Path     string       `json:"path"`
+	Score    float64      `json:"score"`
+	Matches  []MatchRange `json:"matches"`
+	Clause   string       `json:"clause"`
+}
+
+// MatchRange
+// Byte range of a match within a name, `End` is exclusive.
+type MatchRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type Stats struct {
+	Engine string `json:"engine"`
+	// Built is false until the backend has been built for the docset
+	Built     bool   `json:"built"`
+	Entries   uint64 `json:"entries"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+type Search struct {
+	ctx      context.Context
+	backends map[string]Backend
+}
+
+func NewSearch(backends ...Backend) *Search {
+	s := &Search{backends: map[string]Backend{}}
+	for _, backend := range backends {
+		s.backends[backend.Name()] = backend
+	}
+	// settings choosing another engine are reported rather than failing searches
+	config.SetSearchEngines(s.ListEngines())
+	return s
+}
+
+func (s *Search) Startup(ctx context.Context) {
+	s.ctx = ctx
+	config.OnChanged(func(previous config.ConfigObject, current config.ConfigObject, changes []config.Change) {
+		if config.Changed(changes, "searchEngine") || config.Changed(changes, "docSetSearchEngines") {
+			go s.reconfigure(previous, current)
+		}
+	})
+}
+
+// ListEngines
+// Returns the names of the available search backends.
+func (s *Search) ListEngines() []string {
+	engines := make([]string, 0, len(s.backends))
+	for name := range s.backends {
+		engines = append(engines, name)
+	}
+	sort.Strings(engines)
+	return engines
+}
+
+// SearchResult
+// `QueryId` echoes the query id of the search, results of queries superseded by a newer query of the same tab are
+// dropped and flagged `Stale`.
+type SearchResult struct {
+	Engine     string            `json:"engine"`
+	Results    []Hit             `json:"results"`
+	TypeCounts []query.TypeCount `json:"typeCounts"`
+	QueryId    int64             `json:"queryId"`
+	Stale      bool              `json:"stale"`
+	Error      string            `json:"error"`
+}
+
+// SearchDocSet
+// Searches the entries of `docSet` (an installed docset id, or a path within a docset) with the search engine the
+// settings choose for it. `term` may hold `type:` filters, which are combined with `types`. `tabId` and `queryId`
+// identify the query for search as you type, see `inflight.Start`, and can be left empty. `limit` defaults to 10.
+func (s *Search) SearchDocSet(tabId string, queryId int64, docSet string, term string, types []string, limit int) SearchResult {
+	ctx, done := inflight.Start(tabId, queryId)
+	defer done()
+
+	ds, backend, err := s.lookup(docSet)
+	if err != nil {
+		message := fmt.Sprintf("SearchDocSet: Error loading docset \"%s\"\n%s", docSet, err)
+		runtime.LogErrorf(s.ctx, message)
+		return SearchResult{QueryId: queryId, Error: message}
+	}
+
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	searchQuery := query.Parse(term).WithoutKeyword().WithTypes(types)
+	hits, typeCounts, err := backend.Search(ctx, ds, searchQuery, limit)
+	if errors.Is(err, context.Canceled) || inflight.IsStale(tabId, queryId) {
+		return SearchResult{Engine: backend.Name(), QueryId: queryId, Stale: true}
+	}
+	if err != nil {
+		message := fmt.Sprintf("SearchDocSet: Error searching docset \"%s\" with %s\n%s", ds.Id, backend.Name(), err)
+		runtime.LogErrorf(s.ctx, message)
+		return SearchResult{Engine: backend.Name(), QueryId: queryId, Error: message}
+	}
+
+	if hits == nil {
+		hits = []Hit{}
+	}
+	return SearchResult{Engine: backend.Name(), Results: hits, TypeCounts: typeCounts, QueryId: queryId}
+}
+
+// CloseSearchTab
+// Cancels the queries in flight for the search tab `tabId`.
+func (s *Search) CloseSearchTab(tabId string) {
+	inflight.CloseTab(tabId)
+}
+
+// BuildDocSet
+// Builds the search backend chosen for `docSet`, eg its bleve index.
+func (s *Search) BuildDocSet(docSet string) string {
+	ds, backend, err := s.lookup(docSet)
+	if err != nil {
+		message := fmt.Sprintf("BuildDocSet: Error loading docset \"%s\"\n%s", docSet, err)
+		runtime.LogErrorf(s.ctx, message)
+		return message
+	}
+
+	err = backend.Build(ds)
+	if err != nil {
+		message := fmt.Sprintf("BuildDocSet: Error building %s for \"%s\"\n%s", backend.Name(), ds.Id, err)
+		runtime.LogErrorf(s.ctx, message)
+		return message
+	}
+	return ""
+}
+
+// OpenDocSet
+// Gets the search backend chosen for `docSet` ready, so the first search doesn't wait on it.
+func (s *Search) OpenDocSet(docSet string) string {
+	ds, backend, err := s.lookup(docSet)
+	if err != nil {
+		message := fmt.Sprintf("OpenDocSet: Error loading docset \"%s\"\n%s", docSet, err)
+		runtime.LogErrorf(s.ctx, message)
+		return message
+	}
+
+	err = backend.Open(ds)
+	if err != nil {
+		message := fmt.Sprintf("OpenDocSet: Error opening %s for \"%s\"\n%s", backend.Name(), ds.Id, err)
+		runtime.LogErrorf(s.ctx, message)
+		return message
+	}
+	return ""
+}
+
+// CloseDocSet
+// Releases whatever every search backend holds open for `docSet`, eg before the docset is removed.
+func (s *Search) CloseDocSet(docSet string) string {
+	ds, err := docsets.Lookup(docSet)
+	if err != nil {
+		message := fmt.Sprintf("CloseDocSet: Error loading docset \"%s\"\n%s", docSet, err)
+		runtime.LogErrorf(s.ctx, message)
+		return message
+	}
+
+	var errs []error
+	for _, name := range s.ListEngines() {
+		if err = s.backends[name].Close(ds); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		message := fmt.Sprintf("CloseDocSet: Error closing \"%s\"\n%s", ds.Id, errors.Join(errs...))
+		runtime.LogErrorf(s.ctx, message)
+		return message
+	}
+	return ""
+}
+
+type DocSetStatsResult struct {
+	// Engine is the engine the settings choose for the docset
+	Engine string  `json:"engine"`
+	Stats  []Stats `json:"stats"`
+	Error  string  `json:"error"`
+}
+
+// DocSetStats
+// Reports the state of every search backend for `docSet`.
+func (s *Search) DocSetStats(docSet string) DocSetStatsResult {
+	ds, backend, err := s.lookup(docSet)
+	if err != nil {
+		message := fmt.Sprintf("DocSetStats: Error loading docset \"%s\"\n%s", docSet, err)
+		runtime.LogErrorf(s.ctx, message)
+		return DocSetStatsResult{Error: message}
+	}
+
+	result := DocSetStatsResult{Engine: backend.Name(), Stats: []Stats{}}
+	for _, name := range s.ListEngines() {
+		stats, err := s.backends[name].Stats(ds)
+		if err != nil {
+			message := fmt.Sprintf("DocSetStats: Error reading %s stats for \"%s\"\n%s", name, ds.Id, err)
+			runtime.LogErrorf(s.ctx, message)
+			return DocSetStatsResult{Error: message}
+		}
+		result.Stats = append(result.Stats, stats)
+	}
+	return result
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+// lookup loads `docSet` along with the backend the settings choose for it.
+func (s *Search) lookup(docSet string) (docsets.DocSet, Backend, error) {
+	ds, err := docsets.Lookup(docSet)
+	if err != nil {
+		return ds, nil, err
+	}
+
+	engine := Engine(config.Current(), ds.Id)
+	backend, ok := s.backends[engine]
+	if !ok {
+		return ds, nil, fmt.Errorf("unknown search engine \"%s\"", engine)
+	}
+	return ds, backend, nil
+}
+
+// reconfigure moves the installed docsets whose search engine changed in the settings over to their new engine,
+// releasing whatever the previous engine held open for them.
+func (s *Search) reconfigure(previous config.ConfigObject, current config.ConfigObject) {
+	for _, ds := range docsets.Installed() {
+		from, to := Engine(previous, ds.Id), Engine(current, ds.Id)
+		if from == to {
+			continue
+		}
+		if backend, ok := s.backends[from]; ok {
+			if err := backend.Close(ds); err != nil {
+				runtime.LogErrorf(s.ctx, "reconfigure: Error closing %s for \"%s\"\n%s", from, ds.Id, err)
+			}
+		}
+		backend, ok := s.backends[to]
+		if !ok {
+			runtime.LogErrorf(s.ctx, "reconfigure: unknown search engine \"%s\" for \"%s\"", to, ds.Id)
+			continue
+		}
+		if err := backend.Open(ds); err != nil {
+			runtime.LogErrorf(s.ctx, "reconfigure: Error opening %s for \"%s\", it may need building\n%s", to, ds.Id, err)
+			continue
+		}
+		runtime.LogPrintf(s.ctx, "reconfigure: Searching \"%s\" with %s.", ds.Id, to)
+	}
+}
+
+// Engine
+// Returns the name of the search engine `settings` choose for the docset `docSetId`.
+func Engine(settings config.ConfigObject, docSetId string) string {
+	if engine := settings.DocSetSearchEngines[docSetId]; engine != "" {
+		return engine
+	}
+	if settings.SearchEngine != "" {
+		return settings.SearchEngine
+	}
+	return DefaultEngine
+}
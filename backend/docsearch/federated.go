@@ -0,0 +1,303 @@
+package docsearch
+
+import (
+	"context"
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"refi/backend/config"
+	"refi/backend/docsets"
+	"refi/backend/inflight"
+	"refi/backend/query"
+	goruntime "runtime"
+	"sort"
+	"sync"
+)
+
+const (
+	maxSearchAllWorkers = 8
+	searchAllDocSetSize = 25
+	searchAllSize       = 100
+	// docSetPriorityWeight is how much of a hits score depends on the position of its docset in the requested docsets
+	docSetPriorityWeight = 0.25
+)
+
+// GlobalBackend
+// Implemented by backends that can search every enabled docset with a single query, ranking the hits of every docset
+// together rather than merging rankings made per docset. Only used when the settings choose the backend for every
+// enabled docset.
+type GlobalBackend interface {
+	Backend
+	// SearchGlobal returns up to `limit` entries of the enabled docsets matching `searchQuery`, along with the number
+	// of matching entries per type, and the errors of the docsets that failed to search by docset id. Fails only when
+	// every docset failed.
+	SearchGlobal(ctx context.Context, searchQuery query.Query, limit int) ([]Hit, []query.TypeCount, map[string]error, error)
+}
+
+// SearchAllResult
+// Results of searching several docsets, see `SearchAll`. Docsets that failed to search are reported in
+// `DocSetErrors` by docset id, without failing the whole search.
+type SearchAllResult struct {
+	Results      []Hit             `json:"results"`
+	TypeCounts   []query.TypeCount `json:"typeCounts"`
+	DocSetErrors map[string]string `json:"docSetErrors"`
+	QueryId      int64             `json:"queryId"`
+	Stale        bool              `json:"stale"`
+	Error        string            `json:"error"`
+}
+
+type docSetSearch struct {
+	docSet     docsets.DocSet
+	hits       []Hit
+	typeCounts []query.TypeCount
+	err        error
+}
+
+// SearchAll
+// Searches the installed docsets with the ids `docSetIds` concurrently, each with the search engine the settings
+// choose for it, merging the hits into a single ranking. Scores are normalised against the best hit of any docset,
+// then weighted by the position of the docset in `docSetIds`, so earlier docsets rank higher when hits are equally
+// relevant.
+//
+// Without `docSetIds`, every enabled docset is searched. When the settings choose the same engine for all of them, and
+// it can search them with a single query, hits are ranked together by that engine, see `GlobalBackend`.
+//
+// A keyword prefix in `term` (`go:http.Client`) overrides `docSetIds` with the docsets the keyword refers to, and
+// `docset:` filters narrow the docsets searched down to those the filters refer to. `tabId` and `queryId` identify
+// the query for search as you type, see `inflight.Start`, and can be left empty.
+func (s *Search) SearchAll(tabId string, queryId int64, term string, docSetIds []string) SearchAllResult {
+	ctx, done := inflight.Start(tabId, queryId)
+	defer done()
+
+	result := s.searchAll(ctx, term, docSetIds)
+	if result.Stale || inflight.IsStale(tabId, queryId) {
+		return SearchAllResult{QueryId: queryId, Stale: true}
+	}
+	result.QueryId = queryId
+	return result
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+func (s *Search) searchAll(ctx context.Context, term string, docSetIds []string) SearchAllResult {
+	settings := config.Current()
+	searchQuery, keywordDocSets := docsets.ResolveQuery(term, settings.DocSetGroups)
+
+	var selected []docsets.DocSet
+	switch {
+	case len(keywordDocSets) > 0:
+		selected = keywordDocSets
+	case len(docSetIds) > 0:
+		for _, docSetId := range docSetIds {
+			docSet, ok := docsets.Find(docSetId)
+			if !ok {
+				runtime.LogErrorf(s.ctx, "SearchAll: docset not installed \"%s\"", docSetId)
+				continue
+			}
+			selected = append(selected, docSet)
+		}
+	case len(searchQuery.DocSets) > 0:
+		// docsets named by filters are searched even when disabled
+		selected = docsets.Installed()
+	default:
+		enabled := docsets.Enabled()
+		if backend, ok := s.globalBackend(settings, enabled); ok {
+			return s.searchGlobal(ctx, backend, searchQuery)
+		}
+		selected = enabled
+	}
+	if len(searchQuery.DocSets) > 0 {
+		selected = docsets.FilterDocSets(selected, searchQuery.DocSets, settings.DocSetGroups)
+	}
+
+	var searches []*docSetSearch
+	for _, docSet := range selected {
+		searches = append(searches, &docSetSearch{docSet: docSet})
+	}
+	if len(searches) == 0 {
+		return SearchAllResult{Results: []Hit{}, TypeCounts: []query.TypeCount{}}
+	}
+
+	s.runSearches(ctx, settings, searches, searchQuery)
+	if ctx.Err() != nil {
+		return SearchAllResult{Stale: true}
+	}
+
+	bestScore := 0.0
+	for _, docSetSearch := range searches {
+		if docSetSearch.err == nil {
+			bestScore = max(bestScore, maxScore(docSetSearch.hits))
+		}
+	}
+
+	var hits []Hit
+	typeCounts := map[string]int{}
+	docSetErrors := map[string]string{}
+	for rank, docSetSearch := range searches {
+		if docSetSearch.err != nil {
+			message := fmt.Sprintf("SearchAll: Error searching docset \"%s\"\n%s", docSetSearch.docSet.Id, docSetSearch.err)
+			runtime.LogErrorf(s.ctx, message)
+			docSetErrors[docSetSearch.docSet.Id] = message
+			continue
+		}
+
+		priority := 1 - docSetPriorityWeight*float64(rank)/float64(len(searches))
+		hits = append(hits, normaliseScores(docSetSearch.hits, bestScore, priority)...)
+		for _, typeCount := range docSetSearch.typeCounts {
+			typeCounts[typeCount.Type] += typeCount.Count
+		}
+	}
+
+	if len(docSetErrors) == len(searches) {
+		return SearchAllResult{DocSetErrors: docSetErrors, Error: "SearchAll: Every docset failed to search"}
+	}
+
+	mergedTypeCounts := make([]query.TypeCount, 0, len(typeCounts))
+	for rowType, count := range typeCounts {
+		mergedTypeCounts = append(mergedTypeCounts, query.TypeCount{Type: rowType, Count: count})
+	}
+	query.SortTypeCounts(mergedTypeCounts)
+
+	return SearchAllResult{Results: rankHits(hits), TypeCounts: mergedTypeCounts, DocSetErrors: docSetErrors}
+}
+
+// globalBackend returns the backend the settings choose for every docset of `docSets`, when it can search them with
+// a single query.
+func (s *Search) globalBackend(settings config.ConfigObject, docSets []docsets.DocSet) (GlobalBackend, bool) {
+	if len(docSets) == 0 {
+		return nil, false
+	}
+	engine := Engine(settings, docSets[0].Id)
+	for _, docSet := range docSets[1:] {
+		if Engine(settings, docSet.Id) != engine {
+			return nil, false
+		}
+	}
+	backend, ok := s.backends[engine].(GlobalBackend)
+	return backend, ok
+}
+
+// searchGlobal searches every enabled docset with a single query of `backend`.
+func (s *Search) searchGlobal(ctx context.Context, backend GlobalBackend, searchQuery query.Query) SearchAllResult {
+	hits, typeCounts, errs, err := backend.SearchGlobal(ctx, searchQuery, searchAllSize)
+	if ctx.Err() != nil {
+		return SearchAllResult{Stale: true}
+	}
+
+	docSetErrors := map[string]string{}
+	for docSetId, docSetErr := range errs {
+		message := fmt.Sprintf("SearchAll: Error searching docset \"%s\"\n%s", docSetId, docSetErr)
+		runtime.LogErrorf(s.ctx, message)
+		docSetErrors[docSetId] = message
+	}
+	if err != nil {
+		message := fmt.Sprintf("SearchAll: Error searching docsets with %s\n%s", backend.Name(), err)
+		runtime.LogErrorf(s.ctx, message)
+		return SearchAllResult{DocSetErrors: docSetErrors, Error: message}
+	}
+
+	if typeCounts == nil {
+		typeCounts = []query.TypeCount{}
+	}
+	hits = normaliseScores(hits, maxScore(hits), 1)
+	return SearchAllResult{Results: rankHits(hits), TypeCounts: typeCounts, DocSetErrors: docSetErrors}
+}
+
+// runSearches searches every docset with its backend, using a bounded pool of workers.
+func (s *Search) runSearches(ctx context.Context, settings config.ConfigObject, searches []*docSetSearch, searchQuery query.Query) {
+	workers := min(goruntime.NumCPU(), maxSearchAllWorkers, len(searches))
+
+	jobs := make(chan *docSetSearch)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for docSetSearch := range jobs {
+				s.searchDocSet(ctx, settings, docSetSearch, searchQuery)
+			}
+		}()
+	}
+	for _, docSetSearch := range searches {
+		jobs <- docSetSearch
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (s *Search) searchDocSet(ctx context.Context, settings config.ConfigObject, docSetSearch *docSetSearch, searchQuery query.Query) {
+	// superseded while waiting for a worker
+	if err := ctx.Err(); err != nil {
+		docSetSearch.err = err
+		return
+	}
+	engine := Engine(settings, docSetSearch.docSet.Id)
+	backend, ok := s.backends[engine]
+	if !ok {
+		docSetSearch.err = fmt.Errorf("unknown search engine \"%s\"", engine)
+		return
+	}
+
+	hits, typeCounts, err := backend.Search(ctx, docSetSearch.docSet, searchQuery, searchAllDocSetSize)
+	if err != nil {
+		docSetSearch.err = err
+		return
+	}
+	docSetSearch.hits = hits
+	docSetSearch.typeCounts = typeCounts
+}
+
+// normaliseScores scales the scores of a docsets hits by `bestScore`, the best score of the hits of every docset
+// searched, to between 0 and `priority`. Scaling every docset by the same score keeps weak matches in one docset from
+// outranking strong matches in another.
+func normaliseScores(hits []Hit, bestScore float64, priority float64) []Hit {
+	for index := range hits {
+		if bestScore > 0 {
+			hits[index].Score = hits[index].Score / bestScore * priority
+		} else {
+			hits[index].Score = 0
+		}
+	}
+	return hits
+}
+
+func maxScore(hits []Hit) float64 {
+	maxScore := 0.0
+	for _, hit := range hits {
+		maxScore = max(maxScore, hit.Score)
+	}
+	return maxScore
+}
+
+// rankHits drops repeated hits and orders the rest by score, keeping at most `searchAllSize` of them.
+func rankHits(hits []Hit) []Hit {
+	hits = dedupeHits(hits)
+	sort.SliceStable(hits, func(a, b int) bool {
+		return hits[a].Score > hits[b].Score
+	})
+	if len(hits) > searchAllSize {
+		hits = hits[:searchAllSize]
+	}
+	if hits == nil {
+		hits = []Hit{}
+	}
+	return hits
+}
+
+// dedupeHits drops repeated entries (same docset, name, type and path), keeping the best scoring one.
+func dedupeHits(hits []Hit) []Hit {
+	seen := map[string]int{}
+	var deduped []Hit
+	for _, hit := range hits {
+		key := hit.DocSetId + "\x00" + hit.Name + "\x00" + hit.Type + "\x00" + hit.Path
+		if index, ok := seen[key]; ok {
+			if hit.Score > deduped[index].Score {
+				deduped[index] = hit
+			}
+			continue
+		}
+		seen[key] = len(deduped)
+		deduped = append(deduped, hit)
+	}
+	return deduped
+}
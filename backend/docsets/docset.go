@@ -0,0 +1,393 @@
+package docsets
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"refi/backend"
+	"refi/backend/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	docSetSuffix     = ".docset"
+	unknownVersion   = "unversioned"
+	sidecarsDirName  = "sidecars"
+	sidecarDBName    = "sidecar.db"
+	sidecarIndexName = "bleveIndex"
+	// sidecarContentIndexName is the optional full-text index of the docsets pages
+	sidecarContentIndexName = "contentIndex"
+)
+
+// DocSet
+// Metadata of an installed docset, read from its `Info.plist` and the `version` file written on install.
+type DocSet struct {
+	Id             string `json:"id"`
+	Title          string `json:"title"`
+	Keyword        string `json:"keyword"`
+	PlatformFamily string `json:"platformFamily"`
+	IndexFilePath  string `json:"indexFilePath"`
+	FallbackUrl    string `json:"fallbackUrl"`
+	Version        string `json:"version"`
+	Path           string `json:"path"`
+}
+
+func (d DocSet) ResourcesPath() string {
+	return filepath.Join(d.Path, "Contents", "Resources")
+}
+
+func (d DocSet) DBPath() string {
+	return filepath.Join(d.ResourcesPath(), "docSet.dsidx")
+}
+
+func (d DocSet) TokensXMLPath() string {
+	return filepath.Join(d.ResourcesPath(), "Tokens.xml")
+}
+
+func (d DocSet) DocumentsPath() string {
+	return filepath.Join(d.ResourcesPath(), "Documents")
+}
+
+// SidecarPath
+// Directory holding everything Refi derives from this docset (search indexes, imported tables, etc). It lives under
+// the user data dir rather than inside the docset, so the docset files are never modified.
+func (d DocSet) SidecarPath() string {
+	return filepath.Join(backend.AppDataDir(), sidecarsDirName, sanitizePathSegment(d.Id), sanitizePathSegment(d.Version))
+}
+
+func (d DocSet) SidecarDBPath() string {
+	return filepath.Join(d.SidecarPath(), sidecarDBName)
+}
+
+func (d DocSet) SidecarIndexPath() string {
+	return filepath.Join(d.SidecarPath(), sidecarIndexName)
+}
+
+func (d DocSet) SidecarContentIndexPath() string {
+	return filepath.Join(d.SidecarPath(), sidecarContentIndexName)
+}
+
+// PruneSidecars
+// Removes the sidecar directories of every other version of this docset.
+func (d DocSet) PruneSidecars() error {
+	current := d.SidecarPath()
+	versionsPath := filepath.Dir(current)
+	dirEntries, err := os.ReadDir(versionsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, dirEntry := range dirEntries {
+		versionPath := filepath.Join(versionsPath, dirEntry.Name())
+		if versionPath != current {
+			err = os.RemoveAll(versionPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PreviousSidecarIndexPath
+// Returns the most recently modified bleve index of another version of this docset, which can be brought up to date
+// rather than rebuilt after the docset is updated.
+func (d DocSet) PreviousSidecarIndexPath() (string, bool) {
+	current := d.SidecarPath()
+	dirEntries, err := os.ReadDir(filepath.Dir(current))
+	if err != nil {
+		return "", false
+	}
+
+	var previous string
+	var previousModTime time.Time
+	for _, dirEntry := range dirEntries {
+		indexPath := filepath.Join(filepath.Dir(current), dirEntry.Name(), sidecarIndexName)
+		if filepath.Dir(indexPath) == current {
+			continue
+		}
+		info, err := os.Stat(indexPath)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if previous == "" || info.ModTime().After(previousModTime) {
+			previous = indexPath
+			previousModTime = info.ModTime()
+		}
+	}
+	return previous, previous != ""
+}
+
+// RootPath
+// Returns the root directory (`*.docset`) of the docset containing `path`.
+func RootPath(path string) (string, bool) {
+	current := filepath.Clean(path)
+	for {
+		if strings.HasSuffix(current, docSetSuffix) {
+			return current, true
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", false
+		}
+		current = parent
+	}
+}
+
+// FromPath
+// Loads the docset containing `path`, which can be the docset root or any file within it.
+func FromPath(path string) (DocSet, error) {
+	rootPath, ok := RootPath(path)
+	if !ok {
+		return DocSet{}, fmt.Errorf("\"%s\" is not within a docset", path)
+	}
+	return LoadDocSet(rootPath)
+}
+
+type cachedDocSet struct {
+	docSet         DocSet
+	plistModTime   time.Time
+	versionModTime time.Time
+}
+
+var (
+	docSetCache   = map[string]cachedDocSet{}
+	docSetCacheMu sync.Mutex
+)
+
+// LoadDocSet
+// Reads the metadata of the docset at `docSetPath`. Results are cached until either `Info.plist` or `version` change.
+func LoadDocSet(docSetPath string) (DocSet, error) {
+	plistPath := filepath.Join(docSetPath, "Contents", "Info.plist")
+	versionPath := filepath.Join(docSetPath, "version")
+
+	plistInfo, err := os.Stat(plistPath)
+	if err != nil {
+		return DocSet{}, err
+	}
+	var versionModTime time.Time
+	if versionInfo, err := os.Stat(versionPath); err == nil {
+		versionModTime = versionInfo.ModTime()
+	}
+
+	docSetCacheMu.Lock()
+	cached, ok := docSetCache[docSetPath]
+	docSetCacheMu.Unlock()
+	if ok && cached.plistModTime.Equal(plistInfo.ModTime()) && cached.versionModTime.Equal(versionModTime) {
+		return cached.docSet, nil
+	}
+
+	plist, err := readPList(plistPath)
+	if err != nil {
+		return DocSet{}, err
+	}
+
+	version := unknownVersion
+	if data, err := os.ReadFile(versionPath); err == nil {
+		trimmed := strings.NewReplacer("\n", "", "/", "").Replace(string(data))
+		if trimmed != "" {
+			version = trimmed
+		}
+	}
+
+	docSet := DocSet{
+		Id:             plist["CFBundleIdentifier"],
+		Title:          plist["CFBundleName"],
+		Keyword:        plist["DashDocSetKeyword"],
+		PlatformFamily: plist["DocSetPlatformFamily"],
+		IndexFilePath:  plist["dashIndexFilePath"],
+		FallbackUrl:    plist["DashDocSetFallbackURL"],
+		Version:        version,
+		Path:           docSetPath,
+	}
+	if docSet.Id == "" {
+		docSet.Id = strings.TrimSuffix(filepath.Base(docSetPath), docSetSuffix)
+	}
+
+	docSetCacheMu.Lock()
+	docSetCache[docSetPath] = cachedDocSet{
+		docSet:         docSet,
+		plistModTime:   plistInfo.ModTime(),
+		versionModTime: versionModTime,
+	}
+	docSetCacheMu.Unlock()
+
+	return docSet, nil
+}
+
+var (
+	installed   = map[string]DocSet{}
+	installedMu sync.RWMutex
+	// installedKnown is set once the installed docsets were first set
+	installedKnown bool
+	// installedListeners are called whenever the installed docsets change
+	installedListeners []func([]DocSet)
+)
+
+// SetInstalled
+// Replaces the set of installed docsets with the docsets at `docSetPaths`. Docsets that fail to load are skipped, and
+// their errors returned. Listeners are only told when the installed docsets are first set, and whenever they change
+// (a docset is added, removed, moved or updated to another version).
+func SetInstalled(docSetPaths []string) []error {
+	var errs []error
+	docSets := map[string]DocSet{}
+	for _, docSetPath := range docSetPaths {
+		docSet, err := LoadDocSet(docSetPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error loading docset \"%s\": %w", docSetPath, err))
+			continue
+		}
+		docSets[docSet.Id] = docSet
+	}
+
+	installedMu.Lock()
+	changed := !installedKnown || !maps.Equal(installed, docSets)
+	installed, installedKnown = docSets, true
+	var listeners []func([]DocSet)
+	if changed {
+		listeners = append(listeners, installedListeners...)
+	}
+	installedMu.Unlock()
+
+	for _, listener := range listeners {
+		listener(Installed())
+	}
+
+	return errs
+}
+
+// OnInstalled
+// Registers `listener` to be called with the installed docsets every time they change, see `SetInstalled`.
+func OnInstalled(listener func([]DocSet)) {
+	installedMu.Lock()
+	defer installedMu.Unlock()
+
+	installedListeners = append(installedListeners, listener)
+}
+
+// Installed
+// Returns the installed docsets ordered by title.
+func Installed() []DocSet {
+	installedMu.RLock()
+	docSets := make([]DocSet, 0, len(installed))
+	for _, docSet := range installed {
+		docSets = append(docSets, docSet)
+	}
+	installedMu.RUnlock()
+
+	sort.Slice(docSets, func(i, j int) bool {
+		return strings.ToLower(docSets[i].Title) < strings.ToLower(docSets[j].Title)
+	})
+	return docSets
+}
+
+// Enabled
+// Returns the installed docsets that aren't disabled in the settings, ordered by title.
+func Enabled() []DocSet {
+	disabled := map[string]bool{}
+	for _, docSetId := range config.Current().DisabledDocSets {
+		disabled[docSetId] = true
+	}
+
+	var docSets []DocSet
+	for _, docSet := range Installed() {
+		if !disabled[docSet.Id] {
+			docSets = append(docSets, docSet)
+		}
+	}
+	return docSets
+}
+
+// Find
+// Returns the installed docset with the id `id`.
+func Find(id string) (DocSet, bool) {
+	installedMu.RLock()
+	defer installedMu.RUnlock()
+
+	docSet, ok := installed[id]
+	return docSet, ok
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+// readPList reads the scalar values of the top level dictionary in a XML property list, nested dictionaries and
+// arrays are skipped.
+func readPList(plistPath string) (map[string]string, error) {
+	f, err := os.Open(plistPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	decoder := xml.NewDecoder(f)
+	depth := 0
+	key := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			depth++
+			// depth 1 is <plist>, 2 is the top level <dict>, 3 are its keys and values
+			if depth != 3 {
+				continue
+			}
+			switch element.Name.Local {
+			case "key":
+				var text string
+				if err = decoder.DecodeElement(&text, &element); err != nil {
+					return nil, err
+				}
+				key = text
+				depth--
+			case "string", "integer", "real", "date":
+				var text string
+				if err = decoder.DecodeElement(&text, &element); err != nil {
+					return nil, err
+				}
+				values[key] = text
+				depth--
+			case "true", "false":
+				values[key] = element.Name.Local
+			default:
+				if err = decoder.Skip(); err != nil {
+					return nil, err
+				}
+				depth--
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+func sanitizePathSegment(segment string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':':
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(segment))
+	if sanitized == "" || sanitized == "." || sanitized == ".." {
+		return "_"
+	}
+	return sanitized
+}
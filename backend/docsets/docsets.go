@@ -12,13 +12,18 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"refi/backend/config"
+	"refi/backend/query"
 	"strings"
+	"sync"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type DocSets struct {
 	ctx context.Context
+	// reconfigureMu orders reconfigures, which run in the background
+	reconfigureMu sync.Mutex
 }
 
 func NewDocSets() *DocSets {
@@ -27,6 +32,11 @@ func NewDocSets() *DocSets {
 
 func (ds *DocSets) Startup(ctx context.Context) {
 	ds.ctx = ctx
+	config.OnChanged(func(previous config.ConfigObject, current config.ConfigObject, changes []config.Change) {
+		if config.Changed(changes, "docSetsPath") {
+			go ds.reconfigure()
+		}
+	})
 }
 
 func (ds *DocSets) DownloadFeedArchive(eventId string, url string, filePath string) string {
@@ -118,28 +128,96 @@ type GetDownloadedDocSetPaths struct {
 }
 
 func (ds *DocSets) GetDownloadedDocSetPaths(docSetsPath string) GetDownloadedDocSetPaths {
-	var docSetPaths []string
-
-	dirEntries, err := os.ReadDir(docSetsPath)
+	docSetPaths, err := downloadedDocSetPaths(docSetsPath)
 	if err != nil {
 		message := fmt.Sprintf("GetDownloadedDocSetPaths: Error reading dir \"%s\"\n%s", docSetsPath, err.Error())
 		runtime.LogErrorf(ds.ctx, message)
 		return GetDownloadedDocSetPaths{Error: message}
 	}
 
-	docSetPaths = []string{}
-	for _, dirEntry := range dirEntries {
-		if strings.HasSuffix(dirEntry.Name(), ".docset") {
-			docSetPaths = append(docSetPaths, path.Join(docSetsPath, dirEntry.Name()))
-		}
+	// keep the backends view of installed docsets in step with the frontends
+	for _, err := range SetInstalled(docSetPaths) {
+		runtime.LogErrorf(ds.ctx, "GetDownloadedDocSetPaths: %s", err.Error())
 	}
 
 	return GetDownloadedDocSetPaths{DocSetPaths: docSetPaths}
 }
 
+type ResolveQueryResult struct {
+	Query     query.Query `json:"query"`
+	DocSetIds []string    `json:"docSetIds"`
+	Error     string      `json:"error"`
+}
+
+// ResolveQuery
+// Parses a search, resolving a keyword prefix (`go:http.Client`) to the ids of the docsets it should be routed to.
+// `DocSetIds` is empty when there is no prefix, or it doesn't refer to any docsets.
+func (ds *DocSets) ResolveQuery(term string) ResolveQueryResult {
+	parsed, docSets := ResolveQuery(term, config.Current().DocSetGroups)
+
+	docSetIds := []string{}
+	for _, docSet := range docSets {
+		docSetIds = append(docSetIds, docSet.Id)
+	}
+
+	return ResolveQueryResult{Query: parsed, DocSetIds: docSetIds}
+}
+
+type ResolvePathResult struct {
+	Path  ResolvedPath `json:"path"`
+	Error string       `json:"error"`
+}
+
+// ResolvePath
+// Resolves a search result path to its document, fragment and online fallback. `docSet` is a docset id or path.
+func (ds *DocSets) ResolvePath(docSet string, tokenPath string) ResolvePathResult {
+	found, err := Lookup(docSet)
+	if err != nil {
+		message := fmt.Sprintf("ResolvePath: Error loading docset \"%s\"\n%s", docSet, err.Error())
+		runtime.LogErrorf(ds.ctx, message)
+		return ResolvePathResult{Error: message}
+	}
+
+	return ResolvePathResult{Path: found.ResolvePath(tokenPath)}
+}
+
 //-----------------------------------------------------------------------------
 //-----------------------------------------------------------------------------
 
+// reconfigure installs the docsets of the docsets directory after it changed in the settings. The directory is read
+// from the settings current when the reconfigure runs, so when it changes again meanwhile the last change wins.
+func (ds *DocSets) reconfigure() {
+	ds.reconfigureMu.Lock()
+	defer ds.reconfigureMu.Unlock()
+
+	docSetsPath := config.Current().DocSetsPath
+	docSetPaths, err := downloadedDocSetPaths(docSetsPath)
+	if err != nil {
+		runtime.LogErrorf(ds.ctx, "reconfigure: Error reading dir \"%s\"\n%s", docSetsPath, err)
+		return
+	}
+	for _, err := range SetInstalled(docSetPaths) {
+		runtime.LogErrorf(ds.ctx, "reconfigure: %s", err.Error())
+	}
+	runtime.LogPrintf(ds.ctx, "reconfigure: Installed %d docsets from \"%s\".", len(docSetPaths), docSetsPath)
+}
+
+// downloadedDocSetPaths lists the docsets in the docsets directory `docSetsPath`.
+func downloadedDocSetPaths(docSetsPath string) ([]string, error) {
+	dirEntries, err := os.ReadDir(docSetsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	docSetPaths := []string{}
+	for _, dirEntry := range dirEntries {
+		if strings.HasSuffix(dirEntry.Name(), ".docset") {
+			docSetPaths = append(docSetPaths, path.Join(docSetsPath, dirEntry.Name()))
+		}
+	}
+	return docSetPaths, nil
+}
+
 func (ds *DocSets) downloadFile(eventId string, url string, filepath string) error {
 	out, err := os.Create(filepath + ".tmp")
 	if err != nil {
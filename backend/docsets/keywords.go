@@ -0,0 +1,143 @@
+package docsets
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"refi/backend"
+	"refi/backend/config"
+	"refi/backend/query"
+	"strings"
+	"sync"
+	"time"
+)
+
+const aliasesFileName = "aliases.json"
+
+var (
+	aliasesCache        map[string]string
+	aliasesCacheModTime time.Time
+	aliasesCacheMu      sync.Mutex
+)
+
+// ResolveKeyword
+// Returns the installed docsets a query keyword refers to. A keyword is either the name of a docset group, or
+// matches the alias, `DashDocSetKeyword`, `DocSetPlatformFamily` or id of docsets, ignoring case. Group names take
+// precedence, and group members are resolved the same way, so groups can contain other groups.
+func ResolveKeyword(keyword string, groups map[string][]string) []DocSet {
+	aliases := loadAliases()
+	var resolved []DocSet
+	seen := map[string]bool{}
+	visitedGroups := map[string]bool{}
+
+	var resolve func(keyword string)
+	resolve = func(keyword string) {
+		for name, members := range groups {
+			if strings.EqualFold(name, keyword) {
+				if visitedGroups[strings.ToLower(name)] {
+					return
+				}
+				visitedGroups[strings.ToLower(name)] = true
+				for _, member := range members {
+					resolve(member)
+				}
+				return
+			}
+		}
+
+		for _, docSet := range Installed() {
+			if seen[docSet.Id] || !matchesKeyword(docSet, aliases[docSet.Id], keyword) {
+				continue
+			}
+			seen[docSet.Id] = true
+			resolved = append(resolved, docSet)
+		}
+	}
+	resolve(keyword)
+
+	return resolved
+}
+
+// ResolveQuery
+// Parses `input`, resolving its keyword prefix to docsets. When the keyword doesn't refer to any docsets it is kept as
+// part of the search term.
+func ResolveQuery(input string, groups map[string][]string) (query.Query, []DocSet) {
+	parsed := query.Parse(input)
+	if parsed.Keyword == "" {
+		return parsed, nil
+	}
+
+	docSets := ResolveKeyword(parsed.Keyword, groups)
+	if len(docSets) == 0 {
+		return parsed.WithoutKeyword(), nil
+	}
+	return parsed, docSets
+}
+
+// FilterDocSets
+// Returns the docsets of `docSets` matching any of the `docset:` filters of a query, each resolved like a keyword, see
+// `ResolveKeyword`.
+func FilterDocSets(docSets []DocSet, filters []string, groups map[string][]string) []DocSet {
+	matching := map[string]bool{}
+	for _, filter := range filters {
+		for _, docSet := range ResolveKeyword(filter, groups) {
+			matching[docSet.Id] = true
+		}
+	}
+
+	var filtered []DocSet
+	for _, docSet := range docSets {
+		if matching[docSet.Id] {
+			filtered = append(filtered, docSet)
+		}
+	}
+	return filtered
+}
+
+// Synonyms
+// Returns the synonyms searched for in docsets of `platformFamily`, the built-in synonyms of the platform family along
+// with the `synonyms` setting. Searches spanning several platform families pass an empty family.
+func Synonyms(platformFamily string) map[string][]string {
+	return query.Synonyms(platformFamily, config.Current().Synonyms)
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+func matchesKeyword(docSet DocSet, alias string, keyword string) bool {
+	for _, candidate := range []string{alias, docSet.Keyword, docSet.PlatformFamily, docSet.Id} {
+		if candidate != "" && strings.EqualFold(candidate, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAliases reads the docset aliases maintained by the frontend, keyed by docset id.
+func loadAliases() map[string]string {
+	aliasesPath := filepath.Join(backend.UserConfigDir(), backend.AppName, aliasesFileName)
+
+	aliasesCacheMu.Lock()
+	defer aliasesCacheMu.Unlock()
+
+	info, err := os.Stat(aliasesPath)
+	if err != nil {
+		return map[string]string{}
+	}
+	if aliasesCache != nil && aliasesCacheModTime.Equal(info.ModTime()) {
+		return aliasesCache
+	}
+
+	data, err := os.ReadFile(aliasesPath)
+	if err != nil {
+		return map[string]string{}
+	}
+	aliases := map[string]string{}
+	if err = json.Unmarshal(data, &aliases); err != nil {
+		return map[string]string{}
+	}
+
+	aliasesCache = aliases
+	aliasesCacheModTime = info.ModTime()
+	return aliases
+}
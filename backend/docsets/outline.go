@@ -0,0 +1,128 @@
+package docsets
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	appleRefPrefix  = "//apple_ref/"
+	dashRefPrefix   = "//dash_ref"
+	dashAnchorClass = "dashAnchor"
+)
+
+// PageAnchor
+// A symbol anchor within a documentation page.
+type PageAnchor struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Fragment string `json:"fragment"`
+}
+
+// ReadPageAnchors
+// Returns the symbol anchors Dash docsets mark pages up with, in document order. These are elements named (or with an
+// id) like `//apple_ref/cpp/Method/push_back` or `//dash_ref/Method/push_back/0`, usually with the `dashAnchor` class.
+func ReadPageAnchors(documentPath string) ([]PageAnchor, error) {
+	f, err := os.Open(documentPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var anchors []PageAnchor
+	seen := map[string]bool{}
+	tokenizer := html.NewTokenizer(f)
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			if errors.Is(tokenizer.Err(), io.EOF) {
+				return anchors, nil
+			}
+			return anchors, tokenizer.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			anchor, ok := parseAnchor(token)
+			if ok && !seen[anchor.Fragment] {
+				seen[anchor.Fragment] = true
+				anchors = append(anchors, anchor)
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+func parseAnchor(token html.Token) (PageAnchor, bool) {
+	var name, id string
+	isDashAnchor := false
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "name":
+			name = attr.Val
+		case "id":
+			id = attr.Val
+		case "class":
+			for _, class := range strings.Fields(attr.Val) {
+				if class == dashAnchorClass {
+					isDashAnchor = true
+				}
+			}
+		}
+	}
+
+	for _, ref := range []string{name, id} {
+		if anchor, ok := parseRef(ref); ok {
+			return anchor, true
+		}
+	}
+
+	if isDashAnchor && (name != "" || id != "") {
+		fragment := name
+		if fragment == "" {
+			fragment = id
+		}
+		return PageAnchor{Name: unescapeRefSegment(fragment), Fragment: fragment}, true
+	}
+	return PageAnchor{}, false
+}
+
+// parseRef parses `//apple_ref/<language>/<type>/<name>` and `//dash_ref[_<suffix>]/<type>/<name>/<index>` anchors.
+func parseRef(ref string) (PageAnchor, bool) {
+	switch {
+	case strings.HasPrefix(ref, appleRefPrefix):
+		segments := strings.SplitN(strings.TrimPrefix(ref, appleRefPrefix), "/", 3)
+		if len(segments) < 3 {
+			return PageAnchor{}, false
+		}
+		return PageAnchor{
+			Name:     unescapeRefSegment(segments[2]),
+			Type:     unescapeRefSegment(segments[1]),
+			Fragment: ref,
+		}, true
+	case strings.HasPrefix(ref, dashRefPrefix):
+		segments := strings.Split(strings.TrimPrefix(ref, "//"), "/")
+		if len(segments) < 3 {
+			return PageAnchor{}, false
+		}
+		return PageAnchor{
+			Name:     unescapeRefSegment(segments[2]),
+			Type:     unescapeRefSegment(segments[1]),
+			Fragment: ref,
+		}, true
+	}
+	return PageAnchor{}, false
+}
+
+func unescapeRefSegment(segment string) string {
+	if unescaped, err := url.PathUnescape(segment); err == nil {
+		return unescaped
+	}
+	return segment
+}
@@ -0,0 +1,141 @@
+package docsets
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// dashEntryPattern matches the metadata Dash prefixes some `searchIndex` paths with, eg
+// `<dash_entry_name=Foo><dash_entry_originalName=foo.Foo>foo/index.html#Foo`
+var dashEntryPattern = regexp.MustCompile(`<dash_entry_[^>]*>`)
+
+// ResolvedPath
+// Canonical location of a `searchIndex` path.
+type ResolvedPath struct {
+	// DocumentPath is the absolute path of the document, empty for entries that only exist online
+	DocumentPath string `json:"documentPath"`
+	// RelativePath is DocumentPath relative to the docsets `Documents` directory
+	RelativePath string `json:"relativePath"`
+	Fragment     string `json:"fragment"`
+	// FallbackUrl is where the document can be found online, when the docset provides a fallback url
+	FallbackUrl string `json:"fallbackUrl"`
+	Exists      bool   `json:"exists"`
+}
+
+// Lookup
+// Returns the docset identified by `docSet`, either the id of an installed docset or a path within a docset.
+func Lookup(docSet string) (DocSet, error) {
+	if found, ok := Find(docSet); ok {
+		return found, nil
+	}
+	if _, ok := RootPath(docSet); ok {
+		return FromPath(docSet)
+	}
+	return DocSet{}, fmt.Errorf("docset not found \"%s\"", docSet)
+}
+
+// ResolvePath
+// Turns a `searchIndex` path into the document and fragment it points to. Dash entry metadata is stripped, url
+// encoded segments are decoded, and the document is checked to exist (falling back to the undecoded path, and
+// `index.html` for directories).
+func (d DocSet) ResolvePath(tokenPath string) ResolvedPath {
+	tokenPath = StripDashEntryMetadata(tokenPath)
+
+	// entries that only exist online
+	if parsed, err := url.Parse(tokenPath); err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") {
+		return ResolvedPath{FallbackUrl: tokenPath}
+	}
+
+	rawPath, fragment, _ := strings.Cut(tokenPath, "#")
+	rawPath, _, _ = strings.Cut(rawPath, "?")
+	rawPath = strings.TrimPrefix(rawPath, "/")
+
+	resolved := ResolvedPath{Fragment: fragment}
+	if fallbackUrl := d.fallbackUrl(rawPath, fragment); fallbackUrl != "" {
+		resolved.FallbackUrl = fallbackUrl
+	}
+
+	var candidates []string
+	if decodedPath, err := url.PathUnescape(rawPath); err == nil && decodedPath != rawPath {
+		candidates = append(candidates, decodedPath)
+	}
+	candidates = append(candidates, rawPath)
+
+	for _, candidate := range candidates {
+		documentPath, ok := d.documentPath(candidate)
+		if !ok {
+			continue
+		}
+		if resolved.DocumentPath == "" {
+			resolved.DocumentPath = documentPath
+		}
+
+		info, err := os.Stat(documentPath)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			documentPath = filepath.Join(documentPath, "index.html")
+			if _, err = os.Stat(documentPath); err != nil {
+				continue
+			}
+		}
+		resolved.DocumentPath = documentPath
+		resolved.Exists = true
+		break
+	}
+
+	if resolved.DocumentPath != "" {
+		resolved.RelativePath, _ = filepath.Rel(d.DocumentsPath(), resolved.DocumentPath)
+	}
+	return resolved
+}
+
+// ResolveDocumentFile
+// `ResolvePath` for an absolute path within the docsets `Documents` directory, as requested by the webview.
+func (d DocSet) ResolveDocumentFile(documentPath string) ResolvedPath {
+	relativePath, err := filepath.Rel(d.DocumentsPath(), StripDashEntryMetadata(documentPath))
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		return ResolvedPath{DocumentPath: documentPath}
+	}
+	return d.ResolvePath(filepath.ToSlash(relativePath))
+}
+
+// StripDashEntryMetadata
+// Removes the `<dash_entry_...>` metadata Dash embeds in some `searchIndex` paths.
+func StripDashEntryMetadata(tokenPath string) string {
+	return dashEntryPattern.ReplaceAllString(tokenPath, "")
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+// documentPath joins `relativePath` onto the docsets `Documents` directory, refusing paths that escape it.
+func (d DocSet) documentPath(relativePath string) (string, bool) {
+	documentsPath := d.DocumentsPath()
+	documentPath := filepath.Join(documentsPath, filepath.FromSlash(relativePath))
+	if documentPath != documentsPath && !strings.HasPrefix(documentPath, documentsPath+string(os.PathSeparator)) {
+		return "", false
+	}
+	return documentPath, true
+}
+
+func (d DocSet) fallbackUrl(rawPath string, fragment string) string {
+	if d.FallbackUrl == "" {
+		return ""
+	}
+
+	fallbackUrl := d.FallbackUrl
+	if !strings.HasSuffix(fallbackUrl, "/") {
+		fallbackUrl += "/"
+	}
+	fallbackUrl += rawPath
+	if fragment != "" {
+		fallbackUrl += "#" + fragment
+	}
+	return fallbackUrl
+}
@@ -0,0 +1,136 @@
+package docsets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestDocSet creates a docset in a temporary directory holding the documents `files`, relative to `Documents`.
+func newTestDocSet(t *testing.T, fallbackUrl string, files ...string) DocSet {
+	t.Helper()
+	docSet := DocSet{Id: "test", Path: filepath.Join(t.TempDir(), "Test.docset"), FallbackUrl: fallbackUrl}
+	for _, file := range files {
+		filePath := filepath.Join(docSet.DocumentsPath(), filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte("<html></html>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// outside `Documents`, must never be served
+	if err := os.MkdirAll(docSet.ResourcesPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(docSet.ResourcesPath(), "secret.html"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return docSet
+}
+
+func TestResolvePath(t *testing.T) {
+	docSet := newTestDocSet(t, "",
+		"page.html", "foo/page.html", "foo/index.html", "a b/c.html", "raw%20name.html")
+
+	tests := []struct {
+		tokenPath    string
+		relativePath string
+		fragment     string
+		exists       bool
+	}{
+		{"page.html", "page.html", "", true},
+		{"/page.html?lang=go", "page.html", "", true},
+		{"foo/page.html#Foo.Bar", "foo/page.html", "Foo.Bar", true},
+		{"<dash_entry_name=Foo><dash_entry_originalName=foo.Foo>foo/page.html#Foo", "foo/page.html", "Foo", true},
+		{"<dash_entry_menuDescription=x>page.html", "page.html", "", true},
+		{"a%20b/c.html#top", "a b/c.html", "top", true},
+		// the undecoded path is tried when the decoded one doesn't exist
+		{"raw%20name.html", "raw%20name.html", "", true},
+		{"foo", "foo/index.html", "", true},
+		{"foo/#intro", "foo/index.html", "intro", true},
+		{"missing.html#x", "missing.html", "x", false},
+	}
+	for _, test := range tests {
+		resolved := docSet.ResolvePath(test.tokenPath)
+		if resolved.RelativePath != filepath.FromSlash(test.relativePath) || resolved.Fragment != test.fragment ||
+			resolved.Exists != test.exists {
+			t.Errorf("ResolvePath(%q) = %q %q %t, want %q %q %t", test.tokenPath, resolved.RelativePath,
+				resolved.Fragment, resolved.Exists, test.relativePath, test.fragment, test.exists)
+		}
+		if resolved.DocumentPath != filepath.Join(docSet.DocumentsPath(), filepath.FromSlash(test.relativePath)) {
+			t.Errorf("ResolvePath(%q).DocumentPath = %q", test.tokenPath, resolved.DocumentPath)
+		}
+	}
+}
+
+func TestResolvePathFallbackUrl(t *testing.T) {
+	docSet := newTestDocSet(t, "https://example.com/docs", "page.html")
+
+	tests := []struct {
+		tokenPath   string
+		fallbackUrl string
+		exists      bool
+	}{
+		{"page.html#top", "https://example.com/docs/page.html#top", true},
+		{"<dash_entry_name=x>missing.html", "https://example.com/docs/missing.html", false},
+		// entries that only exist online
+		{"https://example.org/online.html#x", "https://example.org/online.html#x", false},
+	}
+	for _, test := range tests {
+		resolved := docSet.ResolvePath(test.tokenPath)
+		if resolved.FallbackUrl != test.fallbackUrl || resolved.Exists != test.exists {
+			t.Errorf("ResolvePath(%q) = %q %t, want %q %t", test.tokenPath, resolved.FallbackUrl, resolved.Exists,
+				test.fallbackUrl, test.exists)
+		}
+	}
+
+	if resolved := newTestDocSet(t, "").ResolvePath("missing.html"); resolved.FallbackUrl != "" {
+		t.Errorf("FallbackUrl = %q without a docset fallback url", resolved.FallbackUrl)
+	}
+}
+
+func TestResolvePathEscapes(t *testing.T) {
+	docSet := newTestDocSet(t, "", "page.html")
+	documentsPrefix := docSet.DocumentsPath() + string(os.PathSeparator)
+
+	for _, tokenPath := range []string{
+		"../secret.html",
+		"../../Resources/secret.html",
+		"foo/../../secret.html",
+		"/../secret.html",
+		"%2e%2e/secret.html",
+		"..%2fsecret.html",
+		"<dash_entry_name=x>../secret.html#top",
+	} {
+		resolved := docSet.ResolvePath(tokenPath)
+		if resolved.Exists {
+			t.Errorf("ResolvePath(%q) resolved to %q outside the documents", tokenPath, resolved.DocumentPath)
+		}
+		if resolved.DocumentPath != "" && !strings.HasPrefix(resolved.DocumentPath, documentsPrefix) {
+			t.Errorf("ResolvePath(%q).DocumentPath = %q, outside the documents", tokenPath, resolved.DocumentPath)
+		}
+	}
+}
+
+func TestResolveDocumentFile(t *testing.T) {
+	docSet := newTestDocSet(t, "", "foo/index.html", "a b/c.html")
+
+	resolved := docSet.ResolveDocumentFile(filepath.Join(docSet.DocumentsPath(), "foo"))
+	if !resolved.Exists || resolved.RelativePath != filepath.Join("foo", "index.html") {
+		t.Errorf("ResolveDocumentFile(foo) = %+v", resolved)
+	}
+
+	resolved = docSet.ResolveDocumentFile(filepath.Join(docSet.DocumentsPath(), "a%20b", "c.html"))
+	if !resolved.Exists || resolved.RelativePath != filepath.Join("a b", "c.html") {
+		t.Errorf("ResolveDocumentFile(a%%20b/c.html) = %+v", resolved)
+	}
+
+	// files outside the documents are left as requested, without being resolved
+	secretPath := filepath.Join(docSet.ResourcesPath(), "secret.html")
+	resolved = docSet.ResolveDocumentFile(secretPath)
+	if resolved.Exists || resolved.DocumentPath != secretPath {
+		t.Errorf("ResolveDocumentFile(%q) = %+v", secretPath, resolved)
+	}
+}
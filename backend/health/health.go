@@ -0,0 +1,227 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"os"
+	"refi/backend/db"
+	"refi/backend/docsets"
+	"refi/backend/indexer"
+	"sync"
+)
+
+const repairEventName = "health|repair"
+
+// Artifacts checked for each docset
+const (
+	ArtifactDB           = "database"
+	ArtifactSidecarDB    = "sidecarDatabase"
+	ArtifactIndex        = "index"
+	ArtifactContentIndex = "contentIndex"
+)
+
+// Repair actions
+const (
+	// ActionNone problems can't be repaired by Refi, the docset needs reinstalling
+	ActionNone = "none"
+	// ActionRebuilt artifacts were rebuilt straight away
+	ActionRebuilt = "rebuilt"
+	// ActionRebuilding artifacts are being rebuilt in the background, indexes report progress with `indexer|progress`
+	// and `indexer|status` events
+	ActionRebuilding = "rebuilding"
+	// ActionFailed repairs failed, see `Error`
+	ActionFailed = "failed"
+)
+
+// Problem
+// A corrupt or missing docset artifact, and what was done about it. Corrupt artifacts are moved to `QuarantinePath`
+// before being rebuilt. Each problem is also sent as a `health|repair` event.
+type Problem struct {
+	DocSetId       string `json:"docSetId"`
+	Artifact       string `json:"artifact"`
+	Path           string `json:"path"`
+	Problem        string `json:"problem"`
+	Action         string `json:"action"`
+	QuarantinePath string `json:"quarantinePath"`
+	JobId          string `json:"jobId"`
+	Error          string `json:"error"`
+}
+
+type Health struct {
+	ctx     context.Context
+	db      *db.DB
+	indexer *indexer.Indexer
+	// startupCheck runs the first health check, once the installed docsets are known
+	startupCheck sync.Once
+}
+
+func NewHealth(database *db.DB, docSetIndexer *indexer.Indexer) *Health {
+	return &Health{db: database, indexer: docSetIndexer}
+}
+
+func (h *Health) Startup(ctx context.Context) {
+	h.ctx = ctx
+	docsets.OnInstalled(func(installed []docsets.DocSet) {
+		h.startupCheck.Do(func() {
+			go h.CheckHealth("")
+		})
+	})
+}
+
+type CheckHealthResult struct {
+	Checked  int       `json:"checked"`
+	Problems []Problem `json:"problems"`
+	Error    string    `json:"error"`
+}
+
+// CheckHealth
+// Validates the databases and search indexes of the installed docset `docSetId` (every installed docset when empty),
+// quarantining and rebuilding any that are corrupt. Runs once on startup, when the installed docsets are first known.
+func (h *Health) CheckHealth(docSetId string) CheckHealthResult {
+	var docSets []docsets.DocSet
+	if docSetId == "" {
+		docSets = docsets.Installed()
+	} else {
+		docSet, ok := docsets.Find(docSetId)
+		if !ok {
+			message := fmt.Sprintf("CheckHealth: docset not installed \"%s\"", docSetId)
+			runtime.LogErrorf(h.ctx, message)
+			return CheckHealthResult{Error: message}
+		}
+		docSets = []docsets.DocSet{docSet}
+	}
+
+	problems := []Problem{}
+	for _, docSet := range docSets {
+		problems = append(problems, h.checkDocSet(docSet)...)
+	}
+
+	runtime.LogPrintf(h.ctx, "CheckHealth: checked %d docsets, %d problems.", len(docSets), len(problems))
+	return CheckHealthResult{Checked: len(docSets), Problems: problems}
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+// checkDocSet checks the databases of the docset before its indexes, as the indexes are rebuilt from them.
+func (h *Health) checkDocSet(docSet docsets.DocSet) []Problem {
+	var problems []Problem
+	report := func(problem Problem) {
+		problem.DocSetId = docSet.Id
+		problems = append(problems, problem)
+		runtime.EventsEmit(h.ctx, repairEventName, problem)
+	}
+
+	// the docset database belongs to the docset, it's never modified
+	if message := h.db.CheckDB(docSet.DBPath()); message != "" {
+		report(Problem{Artifact: ArtifactDB, Path: docSet.DBPath(), Problem: message, Action: ActionNone})
+		return problems
+	}
+
+	sidecarDBPath := docSet.SidecarDBPath()
+	sidecarDBRepaired := false
+	if fileExists(sidecarDBPath) {
+		if message := h.db.CheckDB(sidecarDBPath); message != "" {
+			problem := Problem{Artifact: ArtifactSidecarDB, Path: sidecarDBPath, Problem: message}
+			quarantined := h.db.QuarantineSidecarDB(docSet.DBPath())
+			if quarantined.Error != "" {
+				problem.Action = ActionFailed
+				problem.Error = quarantined.Error
+				report(problem)
+				return problems
+			}
+			problem.QuarantinePath = quarantined.Path
+			problem.Action = ActionRebuilt
+			problem.Error = h.importSearchIndex(docSet)
+			if problem.Error != "" {
+				problem.Action = ActionFailed
+			}
+			report(problem)
+			if problem.Action == ActionFailed {
+				return problems
+			}
+			sidecarDBRepaired = true
+		}
+	}
+
+	if !h.db.TableExists(docSet.DBPath(), "searchIndex") {
+		problem := Problem{
+			Artifact: ArtifactDB,
+			Path:     docSet.DBPath(),
+			Problem:  "CheckHealth: searchIndex table missing",
+			Action:   ActionRebuilt,
+		}
+		problem.Error = h.importSearchIndex(docSet)
+		if problem.Error != "" {
+			problem.Action = ActionFailed
+		}
+		report(problem)
+		if problem.Action == ActionFailed {
+			return problems
+		}
+		sidecarDBRepaired = true
+	}
+
+	indexPath := docSet.SidecarIndexPath()
+	if fileExists(indexPath) {
+		problem := Problem{Artifact: ArtifactIndex, Path: indexPath}
+		if message := h.indexer.CheckIndex(indexPath); message != "" {
+			problem.Problem = message
+			quarantined := h.indexer.QuarantineIndex(indexPath)
+			problem.QuarantinePath = quarantined.Path
+			problem.Error = quarantined.Error
+		} else if sidecarDBRepaired {
+			// built from the entries that were just imported again
+			problem.Problem = "CheckHealth: searchIndex table rebuilt"
+		}
+		if problem.Problem != "" {
+			if problem.Error == "" {
+				started := h.indexer.StartDocSetIndex(indexPath, docSet.DBPath())
+				problem.JobId = started.JobId
+				problem.Error = started.Error
+			}
+			problem.Action = ActionRebuilding
+			if problem.Error != "" {
+				problem.Action = ActionFailed
+			}
+			report(problem)
+		}
+	}
+
+	contentIndexPath := docSet.SidecarContentIndexPath()
+	if fileExists(contentIndexPath) {
+		if message := h.indexer.CheckIndex(contentIndexPath); message != "" {
+			problem := Problem{Artifact: ArtifactContentIndex, Path: contentIndexPath, Problem: message}
+			quarantined := h.indexer.QuarantineIndex(contentIndexPath)
+			problem.QuarantinePath = quarantined.Path
+			problem.Error = quarantined.Error
+			if problem.Error == "" {
+				started := h.indexer.StartContentIndex(docSet.Id)
+				problem.JobId = started.JobId
+				problem.Error = started.Error
+			}
+			problem.Action = ActionRebuilding
+			if problem.Error != "" {
+				problem.Action = ActionFailed
+			}
+			report(problem)
+		}
+	}
+
+	return problems
+}
+
+// importSearchIndex imports the `searchIndex` table from the docsets `Tokens.xml`, the only source Refi can rebuild
+// it from.
+func (h *Health) importSearchIndex(docSet docsets.DocSet) string {
+	if !fileExists(docSet.TokensXMLPath()) {
+		return fmt.Sprintf("CheckHealth: No Tokens.xml to import the searchIndex table from \"%s\"", docSet.TokensXMLPath())
+	}
+	return h.db.ImportSearchIndex(docSet.DBPath(), docSet.TokensXMLPath())
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,336 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"math"
+	"refi/backend/docsets"
+	"refi/backend/statedb"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 1000
+
+	// frecencyHalfLife is how long it takes an opened entry to lose half its boost
+	frecencyHalfLife = 14 * 24 * time.Hour
+)
+
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS historyQueries (
+		docSetId TEXT NOT NULL,
+		query TEXT NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		lastUsed INTEGER NOT NULL,
+		PRIMARY KEY (docSetId, query)
+	);`,
+	`CREATE TABLE IF NOT EXISTS historyOpens (
+		docSetId TEXT NOT NULL,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		path TEXT NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		lastOpened INTEGER NOT NULL,
+		PRIMARY KEY (docSetId, name, type)
+	);`,
+	`CREATE INDEX IF NOT EXISTS historyQueriesLastUsed ON historyQueries (lastUsed);`,
+	`CREATE INDEX IF NOT EXISTS historyOpensLastOpened ON historyOpens (lastOpened);`,
+}
+
+var (
+	// opens caches the opened entries per docset id, invalidated whenever the history changes. Their frecency is
+	// worked out when it is read, so it keeps decaying while the app runs.
+	opens   = map[string]map[string]openedEntry{}
+	opensMu sync.Mutex
+)
+
+type openedEntry struct {
+	count      int
+	lastOpened time.Time
+}
+
+type History struct {
+	ctx context.Context
+}
+
+func NewHistory() *History {
+	return &History{}
+}
+
+func (h *History) Startup(ctx context.Context) {
+	h.ctx = ctx
+}
+
+// RecordQuery
+// Remembers a query searched for in the docset `docSet`, an installed docset id or a path within a docset.
+func (h *History) RecordQuery(docSet string, query string) string {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return ""
+	}
+
+	docSetId := resolveDocSetId(docSet)
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("RecordQuery: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(h.ctx, message)
+		return message
+	}
+
+	_, err = dbConn.Exec(
+		`INSERT INTO historyQueries (docSetId, query, count, lastUsed) VALUES (?, ?, 1, ?)
+		ON CONFLICT (docSetId, query) DO UPDATE SET count = count + 1, lastUsed = excluded.lastUsed;`,
+		docSetId, query, time.Now().Unix(),
+	)
+	if err != nil {
+		message := fmt.Sprintf("RecordQuery: Error recording query \"%s\"\n%s", query, err)
+		runtime.LogErrorf(h.ctx, message)
+		return message
+	}
+
+	return ""
+}
+
+// RecordOpen
+// Remembers a search result opened in the docset `docSet`, an installed docset id or a path within a docset. Entries
+// are identified by name and type, which unlike ids and paths are stable across docset versions.
+func (h *History) RecordOpen(docSet string, name string, entryType string, path string) string {
+	docSetId := resolveDocSetId(docSet)
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("RecordOpen: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(h.ctx, message)
+		return message
+	}
+
+	_, err = dbConn.Exec(
+		`INSERT INTO historyOpens (docSetId, name, type, path, count, lastOpened) VALUES (?, ?, ?, ?, 1, ?)
+		ON CONFLICT (docSetId, name, type) DO UPDATE SET count = count + 1, path = excluded.path, lastOpened = excluded.lastOpened;`,
+		docSetId, name, entryType, path, time.Now().Unix(),
+	)
+	if err != nil {
+		message := fmt.Sprintf("RecordOpen: Error recording \"%s\"\n%s", name, err)
+		runtime.LogErrorf(h.ctx, message)
+		return message
+	}
+	invalidateOpens(docSetId)
+
+	return ""
+}
+
+type QueryRecord struct {
+	DocSetId string `json:"docSetId"`
+	Query    string `json:"query"`
+	Count    int    `json:"count"`
+	LastUsed int64  `json:"lastUsed"`
+}
+
+type OpenRecord struct {
+	DocSetId   string `json:"docSetId"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Path       string `json:"path"`
+	Count      int    `json:"count"`
+	LastOpened int64  `json:"lastOpened"`
+}
+
+type GetHistoryResult struct {
+	Queries []QueryRecord `json:"queries"`
+	Opens   []OpenRecord  `json:"opens"`
+	Error   string        `json:"error"`
+}
+
+// GetHistory
+// Returns the most recent queries and opened results of the docset `docSetId` (of every docset when empty), up to
+// `limit` of each. Timestamps are unix seconds.
+func (h *History) GetHistory(docSetId string, limit int) GetHistoryResult {
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("GetHistory: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(h.ctx, message)
+		return GetHistoryResult{Error: message}
+	}
+
+	queries, err := queryRecords(dbConn, docSetId, limit)
+	if err != nil {
+		message := fmt.Sprintf("GetHistory: Error querying queries for \"%s\"\n%s", docSetId, err)
+		runtime.LogErrorf(h.ctx, message)
+		return GetHistoryResult{Error: message}
+	}
+
+	opens, err := openRecords(dbConn, docSetId, limit)
+	if err != nil {
+		message := fmt.Sprintf("GetHistory: Error querying opened results for \"%s\"\n%s", docSetId, err)
+		runtime.LogErrorf(h.ctx, message)
+		return GetHistoryResult{Error: message}
+	}
+
+	return GetHistoryResult{Queries: queries, Opens: opens}
+}
+
+// ClearHistory
+// Forgets the queries and opened results of the docset `docSetId`, or of every docset when empty.
+func (h *History) ClearHistory(docSetId string) string {
+	dbConn, err := open()
+	if err != nil {
+		message := fmt.Sprintf("ClearHistory: Error opening state db \"%s\"\n%s", statedb.Path(), err)
+		runtime.LogErrorf(h.ctx, message)
+		return message
+	}
+
+	for _, table := range []string{"historyQueries", "historyOpens"} {
+		if docSetId == "" {
+			_, err = dbConn.Exec("DELETE FROM " + table + ";")
+		} else {
+			_, err = dbConn.Exec("DELETE FROM "+table+" WHERE docSetId = ?;", docSetId)
+		}
+		if err != nil {
+			message := fmt.Sprintf("ClearHistory: Error clearing \"%s\"\n%s", table, err)
+			runtime.LogErrorf(h.ctx, message)
+			return message
+		}
+	}
+	invalidateOpens(docSetId)
+
+	return ""
+}
+
+// Frecency
+// Scores how often, and how recently, entries of the docset `docSetId` were opened, for boosting search results.
+// Entries never opened score 0, the score grows logarithmically with the number of opens and halves every
+// `frecencyHalfLife` since the entry was last opened. The returned function is safe to call concurrently.
+func Frecency(docSetId string) (func(name string, entryType string) float64, error) {
+	opened, err := loadOpens(docSetId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return func(name string, entryType string) float64 {
+		entry, ok := opened[frecencyKey(name, entryType)]
+		if !ok {
+			return 0
+		}
+		decay := math.Pow(0.5, now.Sub(entry.lastOpened).Hours()/frecencyHalfLife.Hours())
+		return math.Log2(1+float64(entry.count)) * decay
+	}, nil
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+func open() (*sql.DB, error) {
+	return statedb.Migrate(migrations...)
+}
+
+func queryRecords(dbConn *sql.DB, docSetId string, limit int) ([]QueryRecord, error) {
+	rows, err := dbConn.Query(
+		"SELECT docSetId, query, count, lastUsed FROM historyQueries WHERE ? = '' OR docSetId = ? ORDER BY lastUsed DESC LIMIT ?;",
+		docSetId, docSetId, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []QueryRecord{}
+	for rows.Next() {
+		var record QueryRecord
+		if err = rows.Scan(&record.DocSetId, &record.Query, &record.Count, &record.LastUsed); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func openRecords(dbConn *sql.DB, docSetId string, limit int) ([]OpenRecord, error) {
+	rows, err := dbConn.Query(
+		"SELECT docSetId, name, type, path, count, lastOpened FROM historyOpens WHERE ? = '' OR docSetId = ? ORDER BY lastOpened DESC LIMIT ?;",
+		docSetId, docSetId, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []OpenRecord{}
+	for rows.Next() {
+		var record OpenRecord
+		if err = rows.Scan(&record.DocSetId, &record.Name, &record.Type, &record.Path, &record.Count, &record.LastOpened); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// resolveDocSetId returns the id of the docset `docSet`, history is kept by id so it outlives the docsets path.
+func resolveDocSetId(docSet string) string {
+	if ds, err := docsets.Lookup(docSet); err == nil {
+		return ds.Id
+	}
+	return docSet
+}
+
+func loadOpens(docSetId string) (map[string]openedEntry, error) {
+	opensMu.Lock()
+	defer opensMu.Unlock()
+
+	if opened, ok := opens[docSetId]; ok {
+		return opened, nil
+	}
+
+	dbConn, err := open()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := dbConn.Query("SELECT name, type, count, lastOpened FROM historyOpens WHERE docSetId = ?;", docSetId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	opened := map[string]openedEntry{}
+	for rows.Next() {
+		var name, entryType string
+		var count int
+		var lastOpened int64
+		if err = rows.Scan(&name, &entryType, &count, &lastOpened); err != nil {
+			return nil, err
+		}
+		opened[frecencyKey(name, entryType)] = openedEntry{count: count, lastOpened: time.Unix(lastOpened, 0)}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	opens[docSetId] = opened
+	return opened, nil
+}
+
+func invalidateOpens(docSetId string) {
+	opensMu.Lock()
+	defer opensMu.Unlock()
+
+	if docSetId == "" {
+		opens = map[string]map[string]openedEntry{}
+		return
+	}
+	delete(opens, docSetId)
+}
+
+func frecencyKey(name string, entryType string) string {
+	return name + "\x00" + entryType
+}
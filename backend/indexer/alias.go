@@ -0,0 +1,175 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"os"
+	"refi/backend/docsearch"
+	"refi/backend/docsets"
+	"refi/backend/query"
+	"refi/backend/registry"
+	"sync"
+)
+
+// globalIndex
+// Long-lived bleve index alias over the indexes of every enabled docset, so global searches run as a single query with
+// a single ranking. Members are pinned in the indexers registry, so they stay open outside of its budget and are
+// shared with searches of a single docset. Members join and leave as docsets are installed, enabled and indexed, see
+// `syncGlobalIndex`.
+type globalIndex struct {
+	// mu orders changes to the members, searches in flight hold up member removal through the alias itself
+	mu      sync.Mutex
+	alias   bleve.IndexAlias
+	members map[string]globalMember
+	// stale is set when a member was closed outside of a sync, it joins again on the next search
+	stale bool
+}
+
+type globalMember struct {
+	docSet  docsets.DocSet
+	index   bleve.Index
+	release registry.ReleaseFunc
+}
+
+func newGlobalIndex() *globalIndex {
+	return &globalIndex{alias: bleve.NewIndexAlias(), members: map[string]globalMember{}}
+}
+
+// syncGlobalIndex brings the members of the global index in line with the enabled docsets that have been indexed.
+// Docsets that haven't been indexed yet join once they are, see `swapIndex`, and docsets that were updated are
+// searched through the index of their previous version until then, see `servedIndexPath`.
+func (i *Indexer) syncGlobalIndex() {
+	g := i.global
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	enabled := map[string]docsets.DocSet{}
+	for _, docSet := range docsets.Enabled() {
+		indexPath := i.servedIndexPath(docSet.SidecarIndexPath())
+		if _, err := os.Stat(indexPath); err == nil {
+			enabled[indexPath] = docSet
+		}
+	}
+
+	for indexPath, member := range g.members {
+		if docSet, ok := enabled[indexPath]; ok {
+			member.docSet = docSet
+			g.members[indexPath] = member
+		} else {
+			g.removeMember(indexPath)
+		}
+	}
+	for indexPath, docSet := range enabled {
+		if _, ok := g.members[indexPath]; ok {
+			continue
+		}
+		bleveIndex, release, err := i.pinIndex(indexPath)
+		if err != nil {
+			runtime.LogErrorf(i.ctx, "SearchAll: Error opening index of docset \"%s\"\n%s", docSet.Id, err)
+			continue
+		}
+		g.alias.Add(bleveIndex)
+		g.members[indexPath] = globalMember{docSet: docSet, index: bleveIndex, release: release}
+	}
+	g.stale = false
+}
+
+// closeGlobalMember takes the index at `indexPath` out of the global index and unpins it, so it can be closed.
+func (i *Indexer) closeGlobalMember(indexPath string) {
+	g := i.global
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.members[indexPath]; ok {
+		g.removeMember(indexPath)
+		g.stale = true
+	}
+}
+
+// acquireGlobalIndex returns the global index, along with the docset of each member by index path.
+func (i *Indexer) acquireGlobalIndex() (bleve.IndexAlias, map[string]docsets.DocSet) {
+	i.global.mu.Lock()
+	stale := i.global.stale
+	i.global.mu.Unlock()
+	if stale {
+		i.syncGlobalIndex()
+	}
+
+	g := i.global
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	docSetsByIndex := make(map[string]docsets.DocSet, len(g.members))
+	for indexPath, member := range g.members {
+		docSetsByIndex[indexPath] = member.docSet
+	}
+	return g.alias, docSetsByIndex
+}
+
+// removeMember must be called with the lock held. Removing a member from the alias waits for the searches using it.
+func (g *globalIndex) removeMember(indexPath string) {
+	member := g.members[indexPath]
+	g.alias.Remove(member.index)
+	member.release()
+	delete(g.members, indexPath)
+}
+
+// searchGlobal searches every enabled docset with a single query against the global index, so hits are ranked
+// together rather than per docset. Docsets that fail to search are returned by id, failing the search only when every
+// docset failed.
+func (i *Indexer) searchGlobal(ctx context.Context, searchQuery query.Query, size int) ([]docsearch.Hit, []query.TypeCount, map[string]error, error) {
+	alias, docSetsByIndex := i.acquireGlobalIndex()
+	if len(docSetsByIndex) == 0 {
+		return []docsearch.Hit{}, []query.TypeCount{}, nil, nil
+	}
+
+	// the docsets span platform families, so only common synonyms apply
+	searchQuery = searchQuery.WithSynonyms(docsets.Synonyms(""))
+	searchResult, typeCounts, err := i.search(ctx, alias, searchQuery, size)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, nil, nil, ctxErr
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// members that failed are reported per docset, the remaining members still return hits
+	docSetErrors := map[string]error{}
+	if searchResult.Status != nil {
+		for indexPath, indexErr := range searchResult.Status.Errors {
+			if docSet, ok := docSetsByIndex[indexPath]; ok {
+				docSetErrors[docSet.Id] = indexErr
+			}
+		}
+	}
+	if len(docSetErrors) == len(docSetsByIndex) {
+		return nil, nil, docSetErrors, errors.New("every docset failed to search")
+	}
+
+	// members that joined after the global index was acquired have no docset, their hits are left out
+	knownHits := searchResult.Hits[:0]
+	for _, hit := range searchResult.Hits {
+		if _, ok := docSetsByIndex[hit.Index]; ok {
+			knownHits = append(knownHits, hit)
+		}
+	}
+	searchResult.Hits = knownHits
+
+	hitsByIndex := map[string]search.DocumentMatchCollection{}
+	for _, hit := range searchResult.Hits {
+		hitsByIndex[hit.Index] = append(hitsByIndex[hit.Index], hit)
+	}
+	for indexPath, hits := range hitsByIndex {
+		i.boostFrequentlyOpened(docSetsByIndex[indexPath].Id, hits)
+	}
+
+	matcher := newClauseMatcher(searchQuery)
+	hits := make([]docsearch.Hit, 0, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		hits = append(hits, newDocSearchHit(docSetsByIndex[hit.Index].Id, matcher.searchHit(hit)))
+	}
+	return hits, typeCounts, docSetErrors, nil
+}
@@ -0,0 +1,145 @@
+package indexer
+
+import (
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/registry"
+	"unicode"
+	"unicode/utf8"
+)
+
+// identifierTokenizerName is the tokenizer for code identifiers, see `identifierTokenizer`
+const identifierTokenizerName = "identifier"
+
+// identifierAnalyzerName is the analyzer for symbol names, the identifier tokenizer followed by lower casing
+const identifierAnalyzerName = "identifier"
+
+// wholeNameAnalyzerName is the analyzer of `wholeNameField`, the whole name lower cased as a single term
+const wholeNameAnalyzerName = "wholeName"
+
+// wholeNameField indexes the name of entries with the whole name analyzer
+const wholeNameField = "wholeName"
+
+// identifierTokenizer
+// Splits code identifiers into the words they are made of, so `std::vector::push_back` can be found by "push back"
+// and `net/http.Client.Do` by "ClientDo". Each whitespace separated token is emitted whole, followed by its words,
+// split at anything but letters and digits (`.`, `::`, `/`, `#`, `_`, ...) and at camelCase and PascalCase humps
+// (`HTTPServer` becomes "HTTP" and "Server"), and the words joined back together (`Client.Do` becomes "ClientDo").
+// Token offsets point into the original text, so matches can be highlighted.
+type identifierTokenizer struct{}
+
+func (t *identifierTokenizer) Tokenize(input []byte) analysis.TokenStream {
+	stream := make(analysis.TokenStream, 0)
+	position := 1
+	start := -1
+	for offset := 0; offset <= len(input); {
+		r, size := utf8.DecodeRune(input[offset:])
+		if offset == len(input) || unicode.IsSpace(r) {
+			if start >= 0 {
+				stream = appendIdentifierTokens(stream, input, start, offset, &position)
+				start = -1
+			}
+			if offset == len(input) {
+				break
+			}
+		} else if start < 0 {
+			start = offset
+		}
+		offset += size
+	}
+	return stream
+}
+
+// appendIdentifierTokens appends the tokens of the identifier `input[start:end]`. The whole identifier and its
+// joined words share the position of the first word.
+func appendIdentifierTokens(stream analysis.TokenStream, input []byte, start int, end int, position *int) analysis.TokenStream {
+	whole := input[start:end]
+	stream = append(stream, newToken(whole, start, end, *position))
+
+	words := identifierWords(input, start, end)
+	if len(words) == 0 {
+		*position++
+		return stream
+	}
+	if len(words) == 1 && words[0][0] == start && words[0][1] == end {
+		*position++
+		return stream
+	}
+
+	var joined []byte
+	for _, word := range words {
+		joined = append(joined, input[word[0]:word[1]]...)
+	}
+	if len(words) > 1 && string(joined) != string(whole) {
+		stream = append(stream, newToken(joined, start, end, *position))
+	}
+	for _, word := range words {
+		stream = append(stream, newToken(input[word[0]:word[1]], word[0], word[1], *position))
+		*position++
+	}
+	return stream
+}
+
+// identifierWords returns the byte ranges of the words in `input[start:end]`.
+func identifierWords(input []byte, start int, end int) [][2]int {
+	var words [][2]int
+	wordStart := -1
+	var previous rune
+	for offset := start; offset <= end; {
+		var r rune
+		size := 0
+		if offset < end {
+			r, size = utf8.DecodeRune(input[offset:end])
+		}
+
+		if offset == end || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if wordStart >= 0 {
+				words = append(words, [2]int{wordStart, offset})
+				wordStart = -1
+			}
+			if offset == end {
+				break
+			}
+		} else if wordStart < 0 {
+			wordStart = offset
+		} else if isHump(previous, r, input[offset+size:end]) {
+			words = append(words, [2]int{wordStart, offset})
+			wordStart = offset
+		}
+
+		previous = r
+		offset += size
+	}
+	return words
+}
+
+// isHump reports whether a new word starts at `r`: a lower case letter or digit followed by an upper case letter
+// (`clientDo`), or the last upper case letter of an acronym followed by a lower case letter (`HTTPServer`).
+func isHump(previous rune, r rune, rest []byte) bool {
+	if !unicode.IsUpper(r) {
+		return false
+	}
+	if unicode.IsLower(previous) || unicode.IsDigit(previous) {
+		return true
+	}
+	if unicode.IsUpper(previous) && len(rest) > 0 {
+		next, _ := utf8.DecodeRune(rest)
+		return unicode.IsLower(next)
+	}
+	return false
+}
+
+func newToken(term []byte, start int, end int, position int) *analysis.Token {
+	return &analysis.Token{
+		Term:     append([]byte(nil), term...),
+		Start:    start,
+		End:      end,
+		Position: position,
+		Type:     analysis.AlphaNumeric,
+	}
+}
+
+func init() {
+	registry.RegisterTokenizer(identifierTokenizerName, func(config map[string]interface{}, cache *registry.Cache) (analysis.Tokenizer, error) {
+		return &identifierTokenizer{}, nil
+	})
+}
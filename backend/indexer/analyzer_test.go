@@ -0,0 +1,99 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testToken struct {
+	term     string
+	start    int
+	end      int
+	position int
+}
+
+func TestIdentifierTokenizer(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []testToken
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"Marshal", []testToken{{"Marshal", 0, 7, 1}}},
+		{"::", []testToken{{"::", 0, 2, 1}}},
+		{
+			"std::vector::push_back",
+			[]testToken{
+				{"std::vector::push_back", 0, 22, 1},
+				{"stdvectorpushback", 0, 22, 1},
+				{"std", 0, 3, 1},
+				{"vector", 5, 11, 2},
+				{"push", 13, 17, 3},
+				{"back", 18, 22, 4},
+			},
+		},
+		{
+			"net/http.Client.Do",
+			[]testToken{
+				{"net/http.Client.Do", 0, 18, 1},
+				{"nethttpClientDo", 0, 18, 1},
+				{"net", 0, 3, 1},
+				{"http", 4, 8, 2},
+				{"Client", 9, 15, 3},
+				{"Do", 16, 18, 4},
+			},
+		},
+		// acronyms end before the last upper case letter followed by a lower case letter
+		{
+			"HTTPServer",
+			[]testToken{{"HTTPServer", 0, 10, 1}, {"HTTP", 0, 4, 1}, {"Server", 4, 10, 2}},
+		},
+		{
+			"parseHTTPRequest",
+			[]testToken{{"parseHTTPRequest", 0, 16, 1}, {"parse", 0, 5, 1}, {"HTTP", 5, 9, 2}, {"Request", 9, 16, 3}},
+		},
+		{"URL", []testToken{{"URL", 0, 3, 1}}},
+		// digits belong to the word before them, and end it before an upper case letter
+		{"sha256", []testToken{{"sha256", 0, 6, 1}}},
+		{
+			"utf8DecodeRune",
+			[]testToken{{"utf8DecodeRune", 0, 14, 1}, {"utf8", 0, 4, 1}, {"Decode", 4, 10, 2}, {"Rune", 10, 14, 3}},
+		},
+		{
+			"x86_64",
+			[]testToken{{"x86_64", 0, 6, 1}, {"x8664", 0, 6, 1}, {"x86", 0, 3, 1}, {"64", 4, 6, 2}},
+		},
+		// offsets are in bytes and point into the original text, past whitespace
+		{
+			" Client  Do",
+			[]testToken{{"Client", 1, 7, 1}, {"Do", 9, 11, 2}},
+		},
+		{
+			"café.Größe",
+			[]testToken{{"café.Größe", 0, 13, 1}, {"caféGröße", 0, 13, 1}, {"café", 0, 5, 1}, {"Größe", 6, 13, 2}},
+		},
+		{
+			"-[NSString length] #anchor",
+			[]testToken{
+				{"-[NSString", 0, 10, 1},
+				{"NSString", 0, 10, 1},
+				{"NS", 2, 4, 1},
+				{"String", 4, 10, 2},
+				{"length]", 11, 18, 3},
+				{"length", 11, 17, 3},
+				{"#anchor", 19, 26, 4},
+				{"anchor", 20, 26, 4},
+			},
+		},
+	}
+	tokenizer := &identifierTokenizer{}
+	for _, test := range tests {
+		var got []testToken
+		for _, token := range tokenizer.Tokenize([]byte(test.input)) {
+			got = append(got, testToken{string(token.Term), token.Start, token.End, token.Position})
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Tokenize(%q) = %v, want %v", test.input, got, test.want)
+		}
+	}
+}
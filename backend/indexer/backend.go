@@ -0,0 +1,123 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"refi/backend/docsearch"
+	"refi/backend/docsets"
+	"refi/backend/query"
+)
+
+// BleveBackend
+// Searches the bleve indexes of docsets, see `searchDocSetByTypes`.
+type BleveBackend struct {
+	indexer *Indexer
+}
+
+func NewBleveBackend(indexer *Indexer) *BleveBackend {
+	return &BleveBackend{indexer: indexer}
+}
+
+func (b *BleveBackend) Name() string {
+	return "bleve"
+}
+
+func (b *BleveBackend) Build(docSet docsets.DocSet) error {
+	if message := b.indexer.CreateDocSetIndex(docSet.SidecarIndexPath(), docSet.DBPath()); message != "" {
+		return errors.New(message)
+	}
+	return nil
+}
+
+func (b *BleveBackend) Open(docSet docsets.DocSet) error {
+	_, release, err := b.indexer.findOrOpenIndex(docSet.SidecarIndexPath())
+	if err != nil {
+		return err
+	}
+	release()
+	return nil
+}
+
+func (b *BleveBackend) Search(ctx context.Context, docSet docsets.DocSet, searchQuery query.Query, limit int) ([]docsearch.Hit, []query.TypeCount, error) {
+	// searched by the docset database path, which the index path is resolved from, so the hits are ranked by history
+	result := b.indexer.searchDocSetByTypes(ctx, docSet.DBPath(), searchQuery, limit)
+	if result.Stale {
+		return nil, nil, ctx.Err()
+	}
+	if result.Error != "" {
+		return nil, nil, errors.New(result.Error)
+	}
+
+	hits := make([]docsearch.Hit, 0, len(result.Results))
+	for _, item := range result.Results {
+		hits = append(hits, newDocSearchHit(docSet.Id, item))
+	}
+	return hits, result.TypeCounts, nil
+}
+
+// SearchGlobal
+// Searches the enabled docsets with a single query against the global index, see `globalIndex`.
+func (b *BleveBackend) SearchGlobal(ctx context.Context, searchQuery query.Query, limit int) ([]docsearch.Hit, []query.TypeCount, map[string]error, error) {
+	return b.indexer.searchGlobal(ctx, searchQuery, limit)
+}
+
+func (b *BleveBackend) Close(docSet docsets.DocSet) error {
+	indexPath := docSet.SidecarIndexPath()
+	b.indexer.closeGlobalMember(indexPath)
+	return b.indexer.connections.Remove(indexPath)
+}
+
+func (b *BleveBackend) Stats(docSet docsets.DocSet) (docsearch.Stats, error) {
+	stats := docsearch.Stats{Engine: b.Name()}
+
+	indexPath := docSet.SidecarIndexPath()
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		return stats, nil
+	}
+	bleveIndex, release, err := b.indexer.findOrOpenIndex(indexPath)
+	if err != nil {
+		return stats, err
+	}
+	defer release()
+
+	stats.Built = true
+	stats.Entries, err = bleveIndex.DocCount()
+	if err != nil {
+		return stats, err
+	}
+	err = filepath.WalkDir(indexPath, func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil || dirEntry.IsDir() {
+			return err
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		stats.SizeBytes += info.Size()
+		return nil
+	})
+	return stats, err
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+func newDocSearchHit(docSetId string, item SearchHit) docsearch.Hit {
+	matches := make([]docsearch.MatchRange, 0, len(item.Matches))
+	for _, match := range item.Matches {
+		matches = append(matches, docsearch.MatchRange{Start: match.Start, End: match.End})
+	}
+	return docsearch.Hit{
+		DocSetId: docSetId,
+		Id:       item.Id,
+		Name:     item.Name,
+		Type:     item.RowType,
+		Path:     item.Path,
+		Score:    item.Score,
+		Matches:  matches,
+		Clause:   item.Clause,
+	}
+}
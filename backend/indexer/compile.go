@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"github.com/blevesearch/bleve/v2"
+	blevequery "github.com/blevesearch/bleve/v2/search/query"
+	"refi/backend/query"
+	"strings"
+)
+
+// compileQuery compiles the text of `searchQuery` to a bleve query against the names of entries, see `query.Parse`.
+// Type filters are left to the caller, since types are counted before filtering. Returns nil when the query has
+// nothing to match.
+func compileQuery(searchQuery query.Query) blevequery.Query {
+	if searchQuery.IsEmpty() {
+		return nil
+	}
+
+	var must []blevequery.Query
+	if searchQuery.Term != "" {
+		// analyzed with the identifier analyzer, so the words of the term match the words of names
+		matchQuery := bleve.NewMatchQuery(searchQuery.Term)
+		matchQuery.SetField("name")
+
+		reqexpQuery := bleve.NewRegexpQuery(regexpPattern(searchQuery.Term))
+		reqexpQuery.SetField("name")
+
+		disjunctionQuery := bleve.NewDisjunctionQuery(matchQuery, reqexpQuery)
+		for _, expansion := range searchQuery.Expansions {
+			expansionQuery := bleve.NewMatchQuery(expansion)
+			expansionQuery.SetField("name")
+			expansionQuery.SetBoost(query.SynonymWeight)
+			disjunctionQuery.AddQuery(expansionQuery)
+		}
+		must = append(must, disjunctionQuery)
+	}
+	for _, phrase := range searchQuery.Phrases {
+		must = append(must, phraseQuery(phrase))
+	}
+	if searchQuery.Prefix != "" {
+		prefixQuery := bleve.NewPrefixQuery(strings.ToLower(searchQuery.Prefix))
+		prefixQuery.SetField(wholeNameField)
+		must = append(must, prefixQuery)
+	}
+	if searchQuery.Exact != "" {
+		exactQuery := bleve.NewTermQuery(strings.ToLower(searchQuery.Exact))
+		exactQuery.SetField(wholeNameField)
+		must = append(must, exactQuery)
+	}
+
+	if len(must) == 1 && len(searchQuery.Excluded) == 0 {
+		return must[0]
+	}
+	booleanQuery := bleve.NewBooleanQuery()
+	booleanQuery.AddMust(must...)
+	for _, excluded := range searchQuery.Excluded {
+		booleanQuery.AddMustNot(phraseQuery(excluded))
+	}
+	return booleanQuery
+}
+
+// phraseQuery matches names containing the words of `phrase` in order, as split by the identifier analyzer.
+func phraseQuery(phrase string) blevequery.Query {
+	matchPhraseQuery := bleve.NewMatchPhraseQuery(phrase)
+	matchPhraseQuery.SetField("name")
+	return matchPhraseQuery
+}
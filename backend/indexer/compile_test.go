@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"encoding/json"
+	"refi/backend/query"
+	"testing"
+)
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", `null`},
+		{"type:func", `null`},
+		{
+			"http client",
+			`{"disjuncts":[{"match":"http client","field":"name","prefix_length":0,"fuzziness":0},` +
+				`{"regexp":".{0}http.*client.*","field":"name"}],"min":0}`,
+		},
+		{
+			"a.*b",
+			`{"disjuncts":[{"match":"a.*b","field":"name","prefix_length":0,"fuzziness":0},` +
+				`{"regexp":".{0}a\\.\\*b.*","field":"name"}],"min":0}`,
+		},
+		{`"http client"`, `{"match_phrase":"http client","field":"name","fuzziness":0}`},
+		{"^Json", `{"prefix":"json","field":"wholeName"}`},
+		{"=String", `{"term":"string","field":"wholeName"}`},
+		{
+			"x -old",
+			`{"must":{"conjuncts":[{"disjuncts":[{"match":"x","field":"name","prefix_length":0,"fuzziness":0},` +
+				`{"regexp":".{0}x.*","field":"name"}],"min":0}]},` +
+				`"must_not":{"disjuncts":[{"match_phrase":"old","field":"name","fuzziness":0}],"min":0}}`,
+		},
+		{
+			`^get "http client"`,
+			`{"must":{"conjuncts":[{"match_phrase":"http client","field":"name","fuzziness":0},` +
+				`{"prefix":"get","field":"wholeName"}]}}`,
+		},
+	}
+	for _, test := range tests {
+		got, err := json.Marshal(compileQuery(query.Parse(test.input)))
+		if err != nil {
+			t.Fatalf("compileQuery(%q): %s", test.input, err)
+		}
+		if string(got) != test.want {
+			t.Errorf("compileQuery(%q) = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestCompileQueryExpansions(t *testing.T) {
+	searchQuery := query.Parse("map")
+	searchQuery.Expansions = []string{"dict"}
+
+	got, err := json.Marshal(compileQuery(searchQuery))
+	if err != nil {
+		t.Fatalf("compileQuery: %s", err)
+	}
+	want := `{"disjuncts":[{"match":"map","field":"name","prefix_length":0,"fuzziness":0},` +
+		`{"regexp":".{0}map.*","field":"name"},` +
+		`{"match":"dict","field":"name","boost":0.5,"prefix_length":0,"fuzziness":0}],"min":0}`
+	if string(got) != want {
+		t.Errorf("compileQuery = %s, want %s", got, want)
+	}
+}
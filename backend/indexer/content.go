@@ -0,0 +1,398 @@
+package indexer
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/analysis/lang/de"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/lang/es"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	"github.com/blevesearch/bleve/v2/analysis/lang/it"
+	"github.com/blevesearch/bleve/v2/analysis/lang/nl"
+	"github.com/blevesearch/bleve/v2/analysis/lang/pt"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ru"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/highlight/format/html"
+	blevequery "github.com/blevesearch/bleve/v2/search/query"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"refi/backend/docsets"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentDocumentType = "ContentSection"
+	// contentBatchSize bounds how many sections are held in memory before being written to the index
+	contentBatchSize = 500
+	// maxContentFileSize skips generated pages too large to be useful search results
+	maxContentFileSize = 8 << 20
+	contentSearchSize  = 20
+)
+
+// contentAnalyzers maps the languages pages are written in (their `lang` attribute) to stemming analyzers. Pages in
+// other languages are indexed with the standard analyzer, without stemming.
+var contentAnalyzers = map[string]string{
+	"en": en.AnalyzerName,
+	"de": de.AnalyzerName,
+	"es": es.AnalyzerName,
+	"fr": fr.AnalyzerName,
+	"it": it.AnalyzerName,
+	"ja": cjk.AnalyzerName,
+	"ko": cjk.AnalyzerName,
+	"nl": nl.AnalyzerName,
+	"pt": pt.AnalyzerName,
+	"ru": ru.AnalyzerName,
+	"zh": cjk.AnalyzerName,
+}
+
+// defaultContentLanguage is assumed for pages not declaring their language, most docsets are in English
+const defaultContentLanguage = "en"
+
+// CreateContentIndex
+// Builds the optional full-text index of the pages of a docset, replacing any previous one. Pages are split into
+// sections at their headings, so search results link to the section that matched. `docSet` is the id of an installed
+// docset or a path within it.
+//
+// Like `CreateDocSetIndex`, the index is built next to the existing one and replaces it once complete, progress is
+// reported with `indexer|progress` events and the outcome with an `indexer|status` event, and the job can be cancelled
+// with `CancelIndexJob`.
+func (i *Indexer) CreateContentIndex(docSet string) string {
+	job, ds, message := i.newContentIndexJob("CreateContentIndex", docSet)
+	if message != "" {
+		return message
+	}
+
+	return i.runIndexJob(job, ds.DBPath()).Error
+}
+
+// StartContentIndex
+// `CreateContentIndex` in the background, see `StartDocSetIndex`.
+func (i *Indexer) StartContentIndex(docSet string) StartDocSetIndexResult {
+	job, ds, message := i.newContentIndexJob("StartContentIndex", docSet)
+	if message != "" {
+		return StartDocSetIndexResult{Error: message}
+	}
+
+	go i.runIndexJob(job, ds.DBPath())
+
+	return StartDocSetIndexResult{JobId: job.id}
+}
+
+// RemoveContentIndex
+// Deletes the full-text index of the pages of a docset.
+func (i *Indexer) RemoveContentIndex(docSet string) string {
+	ds, err := docsets.Lookup(docSet)
+	if err != nil {
+		message := fmt.Sprintf("RemoveContentIndex: Error loading docset \"%s\"\n%s", docSet, err)
+		runtime.LogErrorf(i.ctx, message)
+		return message
+	}
+
+	indexPath := ds.SidecarContentIndexPath()
+	err = i.connections.Remove(indexPath)
+	if err != nil {
+		runtime.LogErrorf(i.ctx, "RemoveContentIndex: Error closing bleve index \"%s\"\n%s", indexPath, err)
+	}
+	err = os.RemoveAll(indexPath)
+	if err != nil {
+		message := fmt.Sprintf("RemoveContentIndex: Error removing bleve index \"%s\"\n%s", indexPath, err)
+		runtime.LogErrorf(i.ctx, message)
+		return message
+	}
+
+	return ""
+}
+
+// HasContentIndex
+// Whether the full-text index of the pages of a docset has been built.
+func (i *Indexer) HasContentIndex(docSet string) bool {
+	ds, err := docsets.Lookup(docSet)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(ds.SidecarContentIndexPath())
+	return err == nil
+}
+
+type ContentHit struct {
+	Path    string  `json:"path"`
+	Title   string  `json:"title"`
+	Section string  `json:"section"`
+	Anchor  string  `json:"anchor"`
+	Score   float64 `json:"score"`
+	// Snippets are html, with the matched terms wrapped in `<mark>` and everything else escaped
+	Snippets []string `json:"snippets"`
+}
+
+type SearchContentResult struct {
+	Results []ContentHit `json:"results"`
+	Total   uint64       `json:"total"`
+	Error   string       `json:"error"`
+}
+
+// SearchContent
+// Searches the text of the pages of a docset, see `CreateContentIndex`. Sections containing `term` as a phrase rank
+// above sections only containing all of its words.
+func (i *Indexer) SearchContent(docSet string, term string) SearchContentResult {
+	ds, err := docsets.Lookup(docSet)
+	if err != nil {
+		message := fmt.Sprintf("SearchContent: Error loading docset \"%s\"\n%s", docSet, err)
+		runtime.LogErrorf(i.ctx, message)
+		return SearchContentResult{Error: message}
+	}
+
+	indexPath := ds.SidecarContentIndexPath()
+	if _, err = os.Stat(indexPath); err != nil {
+		message := fmt.Sprintf("SearchContent: No content index for \"%s\"", ds.Id)
+		runtime.LogErrorf(i.ctx, message)
+		return SearchContentResult{Error: message}
+	}
+
+	bleveIndex, release, err := i.findOrOpenIndex(indexPath)
+	if err != nil {
+		message := fmt.Sprintf("SearchContent: Error opening bleve index \"%s\"\n%s", indexPath, err)
+		runtime.LogErrorf(i.ctx, message)
+		return SearchContentResult{Error: message}
+	}
+	defer release()
+
+	searchRequest := bleve.NewSearchRequestOptions(newContentQuery(term), contentSearchSize, 0, false)
+	searchRequest.Fields = []string{"path", "title", "section", "anchor"}
+	searchRequest.Highlight = bleve.NewHighlightWithStyle(html.Name)
+	searchRequest.Highlight.Fields = contentFields()
+	searchResult, err := bleveIndex.Search(searchRequest)
+	if err != nil {
+		message := fmt.Sprintf("SearchContent: Error searching bleve index \"%s\"\n%s", indexPath, err)
+		runtime.LogErrorf(i.ctx, message)
+		return SearchContentResult{Error: message}
+	}
+
+	results := []ContentHit{}
+	for _, hit := range searchResult.Hits {
+		contentHit := ContentHit{Score: hit.Score, Snippets: []string{}}
+		contentHit.Path, _ = hit.Fields["path"].(string)
+		contentHit.Title, _ = hit.Fields["title"].(string)
+		contentHit.Section, _ = hit.Fields["section"].(string)
+		contentHit.Anchor, _ = hit.Fields["anchor"].(string)
+		for _, field := range contentFields() {
+			contentHit.Snippets = append(contentHit.Snippets, hit.Fragments[field]...)
+		}
+		results = append(results, contentHit)
+	}
+
+	return SearchContentResult{Results: results, Total: searchResult.Total}
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+// newContentIndexJob registers a job indexing the pages of `docSet`, `name` prefixes error messages.
+func (i *Indexer) newContentIndexJob(name string, docSet string) (*indexJob, docsets.DocSet, string) {
+	ds, err := docsets.Lookup(docSet)
+	if err != nil {
+		message := fmt.Sprintf("%s: Error loading docset \"%s\"\n%s", name, docSet, err)
+		runtime.LogErrorf(i.ctx, message)
+		return nil, ds, message
+	}
+
+	indexPath := ds.SidecarContentIndexPath()
+	job, err := i.newIndexJob(indexPath)
+	if err != nil {
+		message := fmt.Sprintf("%s: Error starting indexing \"%s\"\n%s", name, indexPath, err)
+		runtime.LogErrorf(i.ctx, message)
+		return nil, ds, message
+	}
+	job.kind = contentIndexJob
+	return job, ds, ""
+}
+
+// indexPages indexes the sections of every page of `docSet` in batches of `contentBatchSize` sections, reporting
+// progress after each batch. Pages that fail to be read or indexed are counted and skipped.
+func (i *Indexer) indexPages(job *indexJob, bleveIndex bleve.Index, docSet docsets.DocSet, status *IndexStatusEvent) error {
+	var documentPaths []string
+	err := filepath.WalkDir(docSet.DocumentsPath(), func(documentPath string, dirEntry fs.DirEntry, err error) error {
+		if ctxErr := job.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			status.ScanErrors++
+			runtime.LogErrorf(i.ctx, "CreateContentIndex: Error reading \"%s\"\n%s", documentPath, err)
+			return nil
+		}
+		if dirEntry.IsDir() || !isHTMLFile(documentPath) {
+			return nil
+		}
+		if info, err := dirEntry.Info(); err != nil || info.Size() > maxContentFileSize {
+			return nil
+		}
+		documentPaths = append(documentPaths, documentPath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	status.Total = len(documentPaths)
+	i.emitProgress(job, status)
+
+	bleveBatch := bleveIndex.NewBatch()
+	for _, documentPath := range documentPaths {
+		if bleveBatch.Size() >= contentBatchSize {
+			if err = i.flushBatch(job, bleveIndex, bleveBatch, status); err != nil {
+				return err
+			}
+		}
+		status.Processed++
+
+		relativePath, err := filepath.Rel(docSet.DocumentsPath(), documentPath)
+		if err == nil {
+			err = indexPage(bleveBatch, documentPath, filepath.ToSlash(relativePath))
+		}
+		if err != nil {
+			status.IndexErrors++
+			runtime.LogErrorf(i.ctx, "CreateContentIndex: Error indexing \"%s\"\n%s", documentPath, err)
+		}
+	}
+	return i.flushBatch(job, bleveIndex, bleveBatch, status)
+}
+
+// indexPage adds the sections of the page at `documentPath` to `bleveBatch`.
+func indexPage(bleveBatch *bleve.Batch, documentPath string, relativePath string) error {
+	f, err := os.Open(documentPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	extracted, err := extractPage(f)
+	if err != nil {
+		return err
+	}
+
+	field := contentField(extracted.Language)
+	for index, section := range extracted.Sections {
+		hash := sha1.Sum([]byte(relativePath + "\x00" + strconv.Itoa(index)))
+		err = bleveBatch.Index(hex.EncodeToString(hash[:]), map[string]interface{}{
+			"_type":   contentDocumentType,
+			"path":    relativePath,
+			"title":   extracted.Title,
+			"section": section.Heading,
+			"anchor":  section.Anchor,
+			field:     section.Text,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentField is the field holding the text of pages in `language`, each language is analyzed differently.
+func contentField(language string) string {
+	language = strings.ToLower(language)
+	language, _, _ = strings.Cut(language, "-")
+	if language == "" {
+		language = defaultContentLanguage
+	}
+	if _, ok := contentAnalyzers[language]; !ok {
+		return "content"
+	}
+	return "content_" + language
+}
+
+// contentFields lists every field page text can be indexed in.
+func contentFields() []string {
+	fields := []string{"content"}
+	for language := range contentAnalyzers {
+		if field := contentField(language); !containsString(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func newContentQuery(term string) blevequery.Query {
+	var queries []blevequery.Query
+	for _, field := range contentFields() {
+		phraseQuery := bleve.NewMatchPhraseQuery(term)
+		phraseQuery.SetField(field)
+		phraseQuery.SetBoost(2)
+
+		matchQuery := bleve.NewMatchQuery(term)
+		matchQuery.SetField(field)
+		matchQuery.SetOperator(blevequery.MatchQueryOperatorAnd)
+
+		queries = append(queries, phraseQuery, matchQuery)
+	}
+
+	for field, boost := range map[string]float64{"section": 3, "title": 1.5} {
+		matchQuery := bleve.NewMatchQuery(term)
+		matchQuery.SetField(field)
+		matchQuery.SetOperator(blevequery.MatchQueryOperatorAnd)
+		matchQuery.SetBoost(boost)
+		queries = append(queries, matchQuery)
+	}
+
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+func newContentIndexMapping() *mapping.IndexMappingImpl {
+	contentIndexMapping := bleve.NewIndexMapping()
+	contentIndexMapping.DefaultMapping.Dynamic = false
+
+	sectionMapping := bleve.NewDocumentMapping()
+	sectionMapping.Dynamic = false
+	contentIndexMapping.AddDocumentMapping(contentDocumentType, sectionMapping)
+
+	for _, field := range []string{"path", "anchor"} {
+		storedFieldMapping := bleve.NewTextFieldMapping()
+		storedFieldMapping.Index = false
+		storedFieldMapping.IncludeInAll = false
+		sectionMapping.AddFieldMappingsAt(field, storedFieldMapping)
+	}
+
+	for _, field := range []string{"title", "section"} {
+		headingFieldMapping := bleve.NewTextFieldMapping()
+		headingFieldMapping.Analyzer = standard.Name
+		headingFieldMapping.IncludeInAll = false
+		sectionMapping.AddFieldMappingsAt(field, headingFieldMapping)
+	}
+
+	// stored with term vectors for highlighting
+	defaultFieldMapping := bleve.NewTextFieldMapping()
+	defaultFieldMapping.Analyzer = standard.Name
+	defaultFieldMapping.IncludeInAll = false
+	defaultFieldMapping.IncludeTermVectors = true
+	sectionMapping.AddFieldMappingsAt("content", defaultFieldMapping)
+	for language, analyzer := range contentAnalyzers {
+		contentFieldMapping := bleve.NewTextFieldMapping()
+		contentFieldMapping.Analyzer = analyzer
+		contentFieldMapping.IncludeInAll = false
+		contentFieldMapping.IncludeTermVectors = true
+		sectionMapping.AddFieldMappingsAt(contentField(language), contentFieldMapping)
+	}
+
+	return contentIndexMapping
+}
+
+func isHTMLFile(filename string) bool {
+	extension := strings.ToLower(filepath.Ext(filename))
+	return extension == ".html" || extension == ".htm"
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
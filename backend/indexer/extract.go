@@ -0,0 +1,182 @@
+package indexer
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skippedElements hold no readable content: navigation, scripts and the like
+var skippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Nav:      true,
+	atom.Svg:      true,
+	atom.Iframe:   true,
+	atom.Button:   true,
+	atom.Select:   true,
+}
+
+// blockElements separate words, text either side of them is never joined
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true, atom.Br: true, atom.Dd: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Figcaption: true, atom.Figure: true, atom.Footer: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Section: true, atom.Table: true, atom.Td: true, atom.Th: true, atom.Tr: true, atom.Ul: true,
+}
+
+var headingElements = map[atom.Atom]bool{
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// pageSection is the visible text of a page from one heading to the next.
+type pageSection struct {
+	Heading string
+	// Anchor is the fragment linking to the section, empty for text before the first anchored heading
+	Anchor string
+	Text   string
+}
+
+// page is the visible text of a documentation page, split into sections.
+type page struct {
+	Title    string
+	Language string
+	Sections []pageSection
+}
+
+// extractPage extracts the title, language (from the `lang` attribute, empty when not declared) and visible text of an
+// html page, skipping navigation, scripts and styles. The text is split into sections at headings, each linked to the
+// id of the heading, or the last anchor (`<a name>`, or any element with an id) before it.
+func extractPage(reader io.Reader) (page, error) {
+	var extracted page
+	var titleText, headingText, sectionText strings.Builder
+	current := pageSection{}
+	pendingAnchor := ""
+	skipping := atom.Atom(0)
+	skipDepth := 0
+	inTitle := false
+	inHeading := atom.Atom(0)
+
+	flush := func() {
+		current.Text = collapseWhitespace(sectionText.String())
+		if current.Text != "" || current.Heading != "" {
+			extracted.Sections = append(extracted.Sections, current)
+		}
+		sectionText.Reset()
+	}
+
+	tokenizer := html.NewTokenizer(reader)
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			if tokenizer.Err() != io.EOF {
+				return extracted, tokenizer.Err()
+			}
+			flush()
+			extracted.Title = collapseWhitespace(titleText.String())
+			if extracted.Title == "" && len(extracted.Sections) > 0 {
+				extracted.Title = extracted.Sections[0].Heading
+			}
+			return extracted, nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if skipping != 0 {
+				if token.DataAtom == skipping && tokenType == html.StartTagToken {
+					skipDepth++
+				}
+				continue
+			}
+
+			var id, name, lang string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "id":
+					id = attr.Val
+				case "name":
+					name = attr.Val
+				case "lang":
+					lang = attr.Val
+				}
+			}
+			if token.DataAtom == atom.Html && lang != "" {
+				extracted.Language = lang
+			}
+
+			switch {
+			case token.DataAtom == atom.Title:
+				inTitle = tokenType == html.StartTagToken
+				continue
+			case skippedElements[token.DataAtom]:
+				if tokenType == html.StartTagToken {
+					skipping = token.DataAtom
+					skipDepth = 1
+				}
+				continue
+			case headingElements[token.DataAtom] && tokenType == html.StartTagToken:
+				flush()
+				current = pageSection{Anchor: pendingAnchor}
+				if id != "" {
+					current.Anchor = id
+				}
+				pendingAnchor = ""
+				inHeading = token.DataAtom
+				headingText.Reset()
+				continue
+			}
+
+			if token.DataAtom == atom.A && name != "" {
+				pendingAnchor = name
+			} else if id != "" {
+				pendingAnchor = id
+			}
+			if blockElements[token.DataAtom] {
+				sectionText.WriteString(" ")
+			}
+
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			if skipping != 0 {
+				if token.DataAtom == skipping {
+					skipDepth--
+					if skipDepth == 0 {
+						skipping = 0
+					}
+				}
+				continue
+			}
+			switch {
+			case token.DataAtom == atom.Title:
+				inTitle = false
+			case token.DataAtom == inHeading:
+				current.Heading = collapseWhitespace(headingText.String())
+				inHeading = 0
+			case blockElements[token.DataAtom]:
+				sectionText.WriteString(" ")
+			}
+
+		case html.TextToken:
+			if skipping != 0 {
+				continue
+			}
+			text := string(tokenizer.Text())
+			switch {
+			case inTitle:
+				titleText.WriteString(text)
+			case inHeading != 0:
+				headingText.WriteString(text)
+			default:
+				sectionText.WriteString(text)
+			}
+		}
+	}
+}
+
+func collapseWhitespace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -2,47 +2,98 @@ package indexer
 
 import (
 	"context"
-	"database/sql"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
-	"github.com/blevesearch/bleve/v2/analysis/char/regexp"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
-	"github.com/blevesearch/bleve/v2/analysis/tokenizer/whitespace"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/single"
 	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	blevequery "github.com/blevesearch/bleve/v2/search/query"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
-	"strings"
+	"refi/backend/config"
+	"refi/backend/docsets"
+	"refi/backend/history"
+	"refi/backend/query"
+	"refi/backend/registry"
+	"sort"
+	"time"
+)
+
+const (
+	// maxOpenIndexes is a soft limit, indexes that are in use are never evicted, and members of the global index
+	// don't count towards it
+	maxOpenIndexes   = 8
+	indexIdleTimeout = 10 * time.Minute
+
+	// boostCandidateSize is how many hits are ranked by frecency, so frequently opened entries just outside the
+	// requested hits can still make it in
+	boostCandidateSize = 50
+	// frecencyWeight is how much opening an entry often and recently raises its score
+	frecencyWeight = 0.5
+
+	typeFacetName = "types"
+	// maxTypeFacets comfortably exceeds the number of entry types used by docsets
+	maxTypeFacets = 200
 )
 
 type Indexer struct {
 	ctx         context.Context
-	connections map[string]bleve.Index
+	connections *registry.Registry[bleve.Index]
+	global      *globalIndex
 }
 
 func NewIndexer() *Indexer {
-	return &Indexer{connections: map[string]bleve.Index{}}
+	return &Indexer{
+		connections: registry.New[bleve.Index](maxOpenIndexes, indexIdleTimeout),
+		global:      newGlobalIndex(),
+	}
 }
 
 func (i *Indexer) Startup(ctx context.Context) {
 	i.ctx = ctx
+	docsets.OnInstalled(func(installed []docsets.DocSet) {
+		go i.syncGlobalIndex()
+	})
+	config.OnChanged(func(previous config.ConfigObject, current config.ConfigObject, changes []config.Change) {
+		if config.Changed(changes, "disabledDocSets") {
+			go i.syncGlobalIndex()
+		}
+	})
+}
+
+func (i *Indexer) Shutdown(ctx context.Context) {
+	err := i.connections.CloseAll()
+	if err != nil {
+		runtime.LogErrorf(i.ctx, "Shutdown: Error closing indexes\n%s", err)
+	}
 }
 
 func (i *Indexer) CloseIndex(indexPath string) string {
-	index := i.connections[indexPath]
-	if index == nil {
+	indexPath, err := resolveIndexPath(indexPath)
+	if err != nil {
+		message := fmt.Sprintf("Close: Error resolving index \"%s\"\n%s", indexPath, err.Error())
+		runtime.LogErrorf(i.ctx, message)
+		return message
+	}
+
+	i.closeGlobalMember(indexPath)
+	if !i.connections.Has(indexPath) {
 		runtime.LogPrintf(i.ctx, fmt.Sprintf("Close: connection not found \"%s\"", indexPath))
 		return ""
 	}
 
-	err := index.Close()
+	err = i.connections.Remove(indexPath)
 	if err != nil {
 		message := fmt.Sprintf("Close: Error closing index \"%s\"\n%s", indexPath, err.Error())
 		runtime.LogErrorf(i.ctx, message)
 		return message
 	}
 
-	delete(i.connections, indexPath)
 	return ""
 }
 
@@ -59,178 +110,266 @@ func (i *IndexedItem) Type() string {
 	return "DocSet"
 }
 
+// DocumentId
+// Stable bleve document id of the entry, derived from its name, type and path rather than its `searchIndex` row id,
+// so an entry keeps its id across rebuilds and docset updates.
+func (i *IndexedItem) DocumentId() string {
+	hash := sha1.Sum([]byte(i.Name + "\x00" + i.RowType + "\x00" + i.Path))
+	return hex.EncodeToString(hash[:])
+}
+
 func (i *IndexedItem) Index(index *bleve.Batch) error {
-	err := index.Index(string(i.Id), i)
+	err := index.Index(i.DocumentId(), i)
 	return err
 }
 
+// CreateDocSetIndex
+// Builds the bleve index for a docset from its `searchIndex` table, replacing any previous index once the new one is
+// complete. Indexes of docsets are written to the docsets sidecar directory rather than `indexPath` itself. Progress
+// is reported with `indexer|progress` events, see `StartDocSetIndex` to index in the background.
 func (i *Indexer) CreateDocSetIndex(indexPath string, dbPath string) string {
-	bleveIndexMapping := i.newBleveIndexMapping()
-	bleveIndex, err := bleve.New(indexPath, bleveIndexMapping)
+	job, err := i.newIndexJob(indexPath)
 	if err != nil {
-		message := fmt.Sprintf("CreateDocSetIndex: Error creating bleve index \"%s\"\n%s", indexPath, err.Error())
+		message := fmt.Sprintf("CreateDocSetIndex: Error starting indexing \"%s\"\n%s", indexPath, err)
 		runtime.LogErrorf(i.ctx, message)
 		return message
 	}
-	defer bleveIndex.Close()
 
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		message := fmt.Sprintf("CreateDocSetIndex: Error opening db \"%s\"\n%s", dbPath, err.Error())
-		runtime.LogErrorf(i.ctx, message)
-		return err.Error()
-	}
-	defer db.Close()
+	status := i.runIndexJob(job, dbPath)
+	return status.Error
+}
 
-	stmt, err := db.Prepare("SELECT si.id, si.name, si.type, si.path FROM searchIndex si;")
-	if err != nil {
-		message := fmt.Sprintf("CreateDocSetIndex: Error preparing query for \"%s\"\n%s", dbPath, err)
-		runtime.LogErrorf(i.ctx, message)
-		return message
+// SearchHit
+// A search result, along with how it matched: the byte ranges of `Name` that matched the term, for highlighting, and
+// the query clause that matched, one of the `Clause*` constants.
+type SearchHit struct {
+	IndexedItem
+	Score   float64      `json:"score"`
+	Matches []MatchRange `json:"matches"`
+	Clause  string       `json:"clause"`
+}
+
+// SearchDocSetResult
+// Results of searching a single docset, see `BleveBackend`. Searches cancelled before they finished are flagged
+// `Stale`.
+type SearchDocSetResult struct {
+	Results    []SearchHit       `json:"results"`
+	TypeCounts []query.TypeCount `json:"typeCounts"`
+	Stale      bool              `json:"stale"`
+	Error      string            `json:"error"`
+}
+
+// searchDocSetByTypes searches entries matching `searchQuery`, up to `size` of them. Type counts cover every entry
+// matching the term, regardless of the type filters, so they can be offered as facets.
+func (i *Indexer) searchDocSetByTypes(ctx context.Context, indexPath string, searchQuery query.Query, size int) SearchDocSetResult {
+
+	docSetId, platformFamily := "", ""
+	if docSet, err := docsets.FromPath(indexPath); err == nil {
+		docSetId, platformFamily = docSet.Id, docSet.PlatformFamily
 	}
-	defer stmt.Close()
+	searchQuery = searchQuery.WithSynonyms(docsets.Synonyms(platformFamily))
 
-	rows, err := stmt.Query()
+	indexPath, err := resolveIndexPath(indexPath)
 	if err != nil {
-		message := fmt.Sprintf("CreateDocSetIndex: Error querying db \"%s\"\n%s", dbPath, err)
+		message := fmt.Sprintf("SearchDocSet: Error resolving index \"%s\"\n%s", indexPath, err)
 		runtime.LogErrorf(i.ctx, message)
-		return message
+		return SearchDocSetResult{Error: message}
 	}
-	defer rows.Close()
 
-	bleveBatch := bleveIndex.NewBatch()
-	for rows.Next() {
-		var docSetRow = IndexedItem{}
-		err = rows.Scan(&docSetRow.Id, &docSetRow.Name, &docSetRow.RowType, &docSetRow.Path)
-		if err != nil {
-			message := fmt.Sprintf("CreateDocSetIndex: Error scanning db row \"%s\"\n%s", dbPath, err.Error())
-			runtime.LogErrorf(i.ctx, message)
-		}
-		err = docSetRow.Index(bleveBatch)
-		if err != nil {
-			message := fmt.Sprintf("CreateDocSetIndex: Error batching bleve index for \"%s\"\n%s", dbPath, err.Error())
-			runtime.LogErrorf(i.ctx, message)
-		}
+	searchSize := size
+	if docSetId != "" && searchSize < boostCandidateSize {
+		searchSize = boostCandidateSize
 	}
-	err = bleveIndex.Batch(bleveBatch)
-	if err != nil {
-		message := fmt.Sprintf("CreateDocSetIndex: Error executing bleve batch for \"%s\"\n%s", dbPath, err.Error())
-		runtime.LogErrorf(i.ctx, message)
-		return message
+	searchResult, typeCounts, err := i.searchIndex(ctx, indexPath, searchQuery, searchSize)
+	if ctx.Err() != nil {
+		return SearchDocSetResult{Stale: true}
 	}
-
-	err = rows.Err()
 	if err != nil {
-		message := fmt.Sprintf("CreateDocSetIndex: Error iterating db row \"%s\"\n%s", dbPath, err)
+		message := fmt.Sprintf("SearchDocSet: Error searching bleve index \"%s\"\n%s", indexPath, err)
 		runtime.LogErrorf(i.ctx, message)
-		return message
+		return SearchDocSetResult{Error: message}
+	}
+	if docSetId != "" {
+		i.boostFrequentlyOpened(docSetId, searchResult.Hits)
+		if len(searchResult.Hits) > size {
+			searchResult.Hits = searchResult.Hits[:size]
+		}
 	}
 
-	runtime.LogPrintf(i.ctx, "CreateDocSetIndex: complete.")
-
-	return ""
-}
+	matcher := newClauseMatcher(searchQuery)
+	results := []SearchHit{}
+	for _, hit := range searchResult.Hits {
+		results = append(results, matcher.searchHit(hit))
+	}
 
-type SearchDocSetResult struct {
-	Results []IndexedItem `json:"results"`
-	Error   string        `json:"error"`
+	return SearchDocSetResult{Results: results, TypeCounts: typeCounts}
 }
 
-func (i *Indexer) SearchDocSet(indexPath string, term string) SearchDocSetResult {
-	bleveIndex, err := i.findOrOpenIndex(indexPath)
+// searchIndex runs `searchQuery` against the index at `indexPath`, returning up to `size` hits along with the
+// number of hits per type. The search result is empty when none of the type filters match a type in the index.
+func (i *Indexer) searchIndex(ctx context.Context, indexPath string, searchQuery query.Query, size int) (*bleve.SearchResult, []query.TypeCount, error) {
+	bleveIndex, release, err := i.findOrOpenIndex(indexPath)
 	if err != nil {
-		message := fmt.Sprintf("SearchDocSet: Error opening bleve index \"%s\"\n%s", indexPath, err)
-		runtime.LogErrorf(i.ctx, message)
-		return SearchDocSetResult{Error: message}
+		return nil, nil, fmt.Errorf("error opening bleve index: %w", err)
 	}
+	defer release()
+	return i.search(ctx, bleveIndex, searchQuery, size)
+}
 
-	matchQuery := bleve.NewMatchQuery(term)
+// search runs `searchQuery` against `bleveIndex`, which is either a single docsets index or the global index. The
+// search stops early when `ctx` is cancelled.
+func (i *Indexer) search(ctx context.Context, bleveIndex bleve.Index, searchQuery query.Query, size int) (*bleve.SearchResult, []query.TypeCount, error) {
+	textQuery := compileQuery(searchQuery)
+	if textQuery == nil {
+		return &bleve.SearchResult{}, []query.TypeCount{}, nil
+	}
 
-	splitTerms := strings.Split(term, " ")
-	updatedTerm := strings.Join(splitTerms, ".*")
-	updatedTerm = fmt.Sprintf(".{0}%s.*", updatedTerm)
-	reqexpQuery := bleve.NewRegexpQuery(updatedTerm)
+	facetRequest := bleve.NewSearchRequestOptions(textQuery, 0, 0, false)
+	facetRequest.AddFacet(typeFacetName, bleve.NewFacetRequest("type", maxTypeFacets))
+	facetResult, err := bleveIndex.SearchInContext(ctx, facetRequest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error counting types: %w", err)
+	}
+	typeCounts := typeCountsFromFacet(facetResult)
 
-	disjunctionQuery := bleve.NewDisjunctionQuery(matchQuery, reqexpQuery)
+	bleveQuery := textQuery
+	if len(searchQuery.Types) > 0 {
+		resolvedTypes := query.ResolveTypes(searchQuery.Types, typeCounts)
+		if len(resolvedTypes) == 0 {
+			return &bleve.SearchResult{}, typeCounts, nil
+		}
+		var typeQueries []blevequery.Query
+		for _, resolvedType := range resolvedTypes {
+			typeQuery := bleve.NewTermQuery(resolvedType)
+			typeQuery.SetField("type")
+			typeQueries = append(typeQueries, typeQuery)
+		}
+		bleveQuery = bleve.NewConjunctionQuery(textQuery, bleve.NewDisjunctionQuery(typeQueries...))
+	}
 
-	searchRequest := bleve.NewSearchRequest(disjunctionQuery)
+	searchRequest := bleve.NewSearchRequestOptions(bleveQuery, size, 0, false)
 
 	searchRequest.Fields = []string{"id", "name", "type", "path"}
+	// locations of the matched terms, see `clauseMatcher`
 	searchRequest.IncludeLocations = true
-	searchResult, err := bleveIndex.Search(searchRequest)
+	searchResult, err := bleveIndex.SearchInContext(ctx, searchRequest)
 	if err != nil {
-		message := fmt.Sprintf("SearchDocSet: Error searching bleve index \"%s\"\n%s", indexPath, err)
-		runtime.LogErrorf(i.ctx, message)
-		return SearchDocSetResult{Error: message}
+		return nil, nil, err
 	}
 
-	var results []IndexedItem
-	if searchResult.Total > 0 {
-		runtime.LogPrintf(i.ctx, "\n")
-		for _, hit := range searchResult.Hits {
-			docSetRow := IndexedItem{
-				Id:      int32(hit.Fields["id"].(float64)),
-				Name:    hit.Fields["name"].(string),
-				RowType: hit.Fields["type"].(string),
-				Path:    hit.Fields["path"].(string),
-			}
-			results = append(results, docSetRow)
-
-			for _, outerValue := range hit.Locations {
-				for key, innerValue := range outerValue {
-					runtime.LogPrintf(i.ctx, "Term: %+v", key)
-					for _, location := range innerValue {
-						runtime.LogPrintf(i.ctx, "  %+v", location)
-					}
-				}
-			}
-			message := fmt.Sprintf("Score: %+v", hit.Score)
-			runtime.LogPrintf(i.ctx, message)
-		}
-		//message := fmt.Sprintf("SearchDocSet: Result - %v", results)
-		//runtime.LogPrintf(s.ctx, message)
+	return searchResult, typeCounts, nil
+}
+
+// boostFrequentlyOpened raises the scores of the entries opened most often and most recently, and reorders the hits
+// by their new scores.
+func (i *Indexer) boostFrequentlyOpened(docSetId string, hits search.DocumentMatchCollection) {
+	frecency, err := history.Frecency(docSetId)
+	if err != nil {
+		runtime.LogErrorf(i.ctx, "SearchDocSet: Error loading history for \"%s\"\n%s", docSetId, err)
+		return
+	}
+
+	for _, hit := range hits {
+		name, _ := hit.Fields["name"].(string)
+		rowType, _ := hit.Fields["type"].(string)
+		hit.Score *= 1 + frecencyWeight*frecency(name, rowType)
 	}
+	sort.SliceStable(hits, func(a, b int) bool {
+		return hits[a].Score > hits[b].Score
+	})
+}
 
-	return SearchDocSetResult{Results: results}
+func indexedItemFromHit(hit *search.DocumentMatch) IndexedItem {
+	return IndexedItem{
+		Id:      int32(hit.Fields["id"].(float64)),
+		Name:    hit.Fields["name"].(string),
+		RowType: hit.Fields["type"].(string),
+		Path:    hit.Fields["path"].(string),
+	}
 }
 
-func (i *Indexer) findOrOpenIndex(indexPath string) (bleve.Index, error) {
-	bleveIndex, ok := i.connections[indexPath]
-	if !ok {
+func typeCountsFromFacet(searchResult *bleve.SearchResult) []query.TypeCount {
+	typeCounts := []query.TypeCount{}
+	facet, ok := searchResult.Facets[typeFacetName]
+	if !ok || facet.Terms == nil {
+		return typeCounts
+	}
+	for _, term := range facet.Terms.Terms() {
+		typeCounts = append(typeCounts, query.TypeCount{Type: term.Term, Count: term.Count})
+	}
+	query.SortTypeCounts(typeCounts)
+	return typeCounts
+}
+
+// findOrOpenIndex returns the registered index for `indexPath`, opening it if it was never opened or has since been
+// evicted. Docset indexes are checked when they are opened, and rebuilt in the background when stale, see
+// `checkIndexSchema`. Docsets that were updated are served by the index of their previous version until their own
+// is ready, see `servedIndexPath`. The returned release function must be called once the caller is done with the
+// index.
+func (i *Indexer) findOrOpenIndex(indexPath string) (bleve.Index, registry.ReleaseFunc, error) {
+	indexPath = i.servedIndexPath(indexPath)
+	return i.connections.Acquire(indexPath, i.openCheckedIndex(indexPath))
+}
+
+// pinIndex is `findOrOpenIndex` for indexes held open for long periods, which don't count towards `maxOpenIndexes`.
+func (i *Indexer) pinIndex(indexPath string) (bleve.Index, registry.ReleaseFunc, error) {
+	indexPath = i.servedIndexPath(indexPath)
+	return i.connections.Pin(indexPath, i.openCheckedIndex(indexPath))
+}
+
+func (i *Indexer) openCheckedIndex(indexPath string) registry.OpenFunc[bleve.Index] {
+	return func() (bleve.Index, error) {
 		bleveIndex, err := bleve.Open(indexPath)
 		if err != nil {
 			return nil, err
 		}
-		i.connections[indexPath] = bleveIndex
+		i.checkIndexSchema(indexPath, bleveIndex)
 		return bleveIndex, nil
 	}
-	return bleveIndex, nil
+}
+
+// openIndex is `findOrOpenIndex` without checking whether the index is stale.
+func (i *Indexer) openIndex(indexPath string) (bleve.Index, registry.ReleaseFunc, error) {
+	return i.connections.Acquire(indexPath, func() (bleve.Index, error) {
+		return bleve.Open(indexPath)
+	})
+}
+
+// resolveIndexPath maps index paths within a docset to the docsets sidecar index, any other path is used as is.
+func resolveIndexPath(indexPath string) (string, error) {
+	if _, ok := docsets.RootPath(indexPath); !ok {
+		return indexPath, nil
+	}
+
+	docSet, err := docsets.FromPath(indexPath)
+	if err != nil {
+		return indexPath, err
+	}
+	return docSet.SidecarIndexPath(), nil
 }
 
 func (i *Indexer) newBleveIndexMapping() *mapping.IndexMappingImpl {
 	bleveIndexMapping := bleve.NewIndexMapping()
-	err := bleveIndexMapping.AddCustomCharFilter("regexp", map[string]interface{}{
-		"type":    regexp.Name,
-		"regexp":  "[.]",
-		"replace": " ",
+	err := bleveIndexMapping.AddCustomAnalyzer(identifierAnalyzerName, map[string]interface{}{
+		"type":      custom.Name,
+		"tokenizer": identifierTokenizerName,
+		"token_filters": []string{
+			lowercase.Name,
+		},
 	})
 	if err != nil {
-		message := fmt.Sprintf("newBleveIndexMapping: Error adding custom char filter\n%s", err)
+		message := fmt.Sprintf("newBleveIndexMapping: Error adding identifier analyzer\n%s", err)
 		runtime.LogErrorf(i.ctx, message)
 	}
-
-	err = bleveIndexMapping.AddCustomAnalyzer("custom", map[string]interface{}{
-		"type":         custom.Name,
-		"char_filters": []string{
-			//"regexp",
-		},
-		"tokenizer": whitespace.Name,
+	err = bleveIndexMapping.AddCustomAnalyzer(wholeNameAnalyzerName, map[string]interface{}{
+		"type":      custom.Name,
+		"tokenizer": single.Name,
 		"token_filters": []string{
 			lowercase.Name,
 		},
 	})
 	if err != nil {
-		message := fmt.Sprintf("newBleveIndexMapping: Error adding custom analyzer\n%s", err)
+		message := fmt.Sprintf("newBleveIndexMapping: Error adding whole name analyzer\n%s", err)
 		runtime.LogErrorf(i.ctx, message)
 	}
 
@@ -242,12 +381,20 @@ func (i *Indexer) newBleveIndexMapping() *mapping.IndexMappingImpl {
 	docSetDocumentMapping.AddFieldMappingsAt("Id", idFieldMapping)
 
 	nameFieldMapping := bleve.NewTextFieldMapping()
-	nameFieldMapping.Analyzer = "custom"
+	nameFieldMapping.Analyzer = identifierAnalyzerName
 	nameFieldMapping.IncludeTermVectors = true
-	docSetDocumentMapping.AddFieldMappingsAt("name", nameFieldMapping)
-
+	// the whole name as a single term as well, for `^prefix` and `=exact` searches
+	wholeNameFieldMapping := bleve.NewTextFieldMapping()
+	wholeNameFieldMapping.Name = wholeNameField
+	wholeNameFieldMapping.Analyzer = wholeNameAnalyzerName
+	wholeNameFieldMapping.Store = false
+	wholeNameFieldMapping.IncludeInAll = false
+	docSetDocumentMapping.AddFieldMappingsAt("name", nameFieldMapping, wholeNameFieldMapping)
+
+	// indexed verbatim for filtering and faceting, but kept out of `_all` so types don't match search terms
 	typeFieldMapping := bleve.NewTextFieldMapping()
-	typeFieldMapping.Index = false
+	typeFieldMapping.Analyzer = keyword.Name
+	typeFieldMapping.IncludeInAll = false
 	docSetDocumentMapping.AddFieldMappingsAt("type", typeFieldMapping)
 
 	pathFieldMapping := bleve.NewTextFieldMapping()
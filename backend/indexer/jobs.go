@@ -0,0 +1,452 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"os"
+	"path/filepath"
+	"refi/backend/db"
+	"refi/backend/docsets"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// indexBatchSize bounds how many rows are held in memory before being written to the index
+	indexBatchSize = 1000
+
+	progressEventName = "indexer|progress"
+	statusEventName   = "indexer|status"
+)
+
+// Index job statuses
+const (
+	IndexStatusDone      = "done"
+	IndexStatusCancelled = "cancelled"
+	IndexStatusFailed    = "failed"
+)
+
+type IndexProgressEvent struct {
+	JobId     string `json:"jobId"`
+	IndexPath string `json:"indexPath"`
+	Processed int    `json:"processed"`
+	Total     int    `json:"total"`
+}
+
+// IndexStatusEvent
+// Sent once an index job finishes, whether it completed, was cancelled or failed. Rows that fail to be read or indexed
+// are counted rather than failing the job.
+type IndexStatusEvent struct {
+	JobId       string `json:"jobId"`
+	IndexPath   string `json:"indexPath"`
+	Status      string `json:"status"`
+	Processed   int    `json:"processed"`
+	Total       int    `json:"total"`
+	ScanErrors  int    `json:"scanErrors"`
+	IndexErrors int    `json:"indexErrors"`
+	Error       string `json:"error"`
+}
+
+type indexJob struct {
+	id string
+	// indexPath is the index path as requested, reported in events so the frontend can match them to its docset
+	indexPath         string
+	resolvedIndexPath string
+	kind              indexJobKind
+	// diff is what an update job changed, nil when the index was built from scratch
+	diff   *indexDiff
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type indexJobKind int
+
+// Index job kinds
+const (
+	// createIndexJob indexes every `searchIndex` row, see `CreateDocSetIndex`
+	createIndexJob indexJobKind = iota
+	// updateIndexJob brings a copy of the existing index up to date rather than indexing every row, see
+	// `UpdateDocSetIndex`
+	updateIndexJob
+	// contentIndexJob indexes the pages of a docset, see `CreateContentIndex`
+	contentIndexJob
+)
+
+// String names the bound method starting jobs of kind `k`, logs are prefixed with it.
+func (k indexJobKind) String() string {
+	switch k {
+	case updateIndexJob:
+		return "UpdateDocSetIndex"
+	case contentIndexJob:
+		return "CreateContentIndex"
+	default:
+		return "CreateDocSetIndex"
+	}
+}
+
+// indexDiff
+// The documents already in an index being updated, and the changes made to bring it up to date.
+type indexDiff struct {
+	// existingIds are the `searchIndex` row ids of the documents in the index, by document id
+	existingIds map[string]int32
+	currentIds  map[string]bool
+	added       int
+	updated     int
+	removed     int
+}
+
+var (
+	jobs      = map[string]*indexJob{}
+	jobsMu    sync.Mutex
+	lastJobId atomic.Int64
+)
+
+type StartDocSetIndexResult struct {
+	JobId string `json:"jobId"`
+	Error string `json:"error"`
+}
+
+// StartDocSetIndex
+// `CreateDocSetIndex` in the background. Progress is reported with `indexer|progress` events, and the outcome with an
+// `indexer|status` event. Only one job can index a docset at a time.
+func (i *Indexer) StartDocSetIndex(indexPath string, dbPath string) StartDocSetIndexResult {
+	job, err := i.newIndexJob(indexPath)
+	if err != nil {
+		message := fmt.Sprintf("StartDocSetIndex: Error starting indexing \"%s\"\n%s", indexPath, err)
+		runtime.LogErrorf(i.ctx, message)
+		return StartDocSetIndexResult{Error: message}
+	}
+
+	go i.runIndexJob(job, dbPath)
+
+	return StartDocSetIndexResult{JobId: job.id}
+}
+
+// CancelIndexJob
+// Stops the index job `jobId`, leaving any previous index in place.
+func (i *Indexer) CancelIndexJob(jobId string) string {
+	jobsMu.Lock()
+	job, ok := jobs[jobId]
+	jobsMu.Unlock()
+	if !ok {
+		message := fmt.Sprintf("CancelIndexJob: job not found \"%s\"", jobId)
+		runtime.LogErrorf(i.ctx, message)
+		return message
+	}
+
+	job.cancel()
+	return ""
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+// newIndexJob registers a job indexing `indexPath`, failing when another job is already indexing it.
+func (i *Indexer) newIndexJob(indexPath string) (*indexJob, error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	resolvedIndexPath, err := resolveIndexPath(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.resolvedIndexPath == resolvedIndexPath {
+			return nil, fmt.Errorf("already being indexed by job \"%s\"", job.id)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &indexJob{
+		id:                strconv.FormatInt(lastJobId.Add(1), 10),
+		indexPath:         indexPath,
+		resolvedIndexPath: resolvedIndexPath,
+		ctx:               ctx,
+		cancel:            cancel,
+	}
+	jobs[job.id] = job
+	return job, nil
+}
+
+// endIndexJob unregisters `job`, freeing its index for other jobs.
+func (i *Indexer) endIndexJob(job *indexJob) {
+	job.cancel()
+	jobsMu.Lock()
+	delete(jobs, job.id)
+	jobsMu.Unlock()
+}
+
+// runIndexJob builds the index next to the existing one and swaps it in once complete, so cancelled and failed jobs
+// leave the existing index untouched.
+func (i *Indexer) runIndexJob(job *indexJob, dbPath string) IndexStatusEvent {
+	defer i.endIndexJob(job)
+
+	name := job.kind.String()
+
+	status := IndexStatusEvent{JobId: job.id, IndexPath: job.indexPath, Status: IndexStatusDone}
+	err := i.buildIndex(job, dbPath, &status)
+	switch {
+	case errors.Is(err, context.Canceled):
+		status.Status = IndexStatusCancelled
+		runtime.LogPrintf(i.ctx, "%s: cancelled \"%s\".", name, job.indexPath)
+	case err != nil:
+		status.Status = IndexStatusFailed
+		status.Error = fmt.Sprintf("%s: Error indexing \"%s\"\n%s", name, job.indexPath, err)
+		runtime.LogErrorf(i.ctx, status.Error)
+	case job.diff != nil:
+		runtime.LogPrintf(i.ctx, "%s: complete, %d added, %d updated, %d removed, %d scan errors, %d index errors.",
+			name, job.diff.added, job.diff.updated, job.diff.removed, status.ScanErrors, status.IndexErrors)
+	case job.kind == contentIndexJob:
+		runtime.LogPrintf(i.ctx, "%s: complete, %d pages, %d read errors, %d index errors.",
+			name, status.Processed, status.ScanErrors, status.IndexErrors)
+	default:
+		runtime.LogPrintf(i.ctx, "%s: complete, %d rows, %d scan errors, %d index errors.",
+			name, status.Processed, status.ScanErrors, status.IndexErrors)
+	}
+
+	runtime.EventsEmit(i.ctx, statusEventName, status)
+	return status
+}
+
+func (i *Indexer) buildIndex(job *indexJob, dbPath string, status *IndexStatusEvent) error {
+	indexPath := job.resolvedIndexPath
+	docSet, docSetErr := docsets.FromPath(dbPath)
+	if job.kind == contentIndexJob && docSetErr != nil {
+		return fmt.Errorf("error loading docset: %w", docSetErr)
+	}
+
+	buildPath := indexPath + ".building"
+	err := os.RemoveAll(buildPath)
+	if err != nil {
+		return fmt.Errorf("error removing incomplete index: %w", err)
+	}
+	err = os.MkdirAll(filepath.Dir(buildPath), 0755)
+	if err != nil {
+		return fmt.Errorf("error creating dir: %w", err)
+	}
+
+	bleveIndex, err := i.newBuildIndex(job, docSet, docSetErr, buildPath)
+	if err != nil {
+		return err
+	}
+	if job.kind == contentIndexJob {
+		err = i.indexPages(job, bleveIndex, docSet, status)
+	} else {
+		err = i.indexRows(job, bleveIndex, dbPath, status)
+		if err == nil {
+			// indexes of databases outside a docset have no docset version, they are never checked
+			err = writeIndexMetadata(bleveIndex, docSet.Version)
+		}
+	}
+	closeErr := bleveIndex.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.RemoveAll(buildPath)
+		return err
+	}
+
+	err = i.swapIndex(job, buildPath)
+	if err != nil {
+		return err
+	}
+
+	if docSetErr == nil && job.kind != contentIndexJob {
+		// the index of the previous version may have been serving searches until now, see `servedIndexPath`
+		if previousPath, ok := docSet.PreviousSidecarIndexPath(); ok {
+			err = i.connections.Remove(previousPath)
+			if err != nil {
+				runtime.LogErrorf(i.ctx, "%s: Error closing bleve index \"%s\"\n%s", job.kind, previousPath, err)
+			}
+		}
+		err = docSet.PruneSidecars()
+		if err != nil {
+			runtime.LogErrorf(i.ctx, "%s: Error removing outdated sidecars for \"%s\"\n%s", job.kind, docSet.Id, err)
+		}
+	}
+	return nil
+}
+
+// swapIndex replaces the index of `job` with the one built at `buildPath`. The existing index is moved aside before
+// its connection is closed, so searches racing the swap either fail to find an index or open the new one, rather
+// than reopening the one being deleted.
+func (i *Indexer) swapIndex(job *indexJob, buildPath string) error {
+	indexPath := job.resolvedIndexPath
+	replacedPath := indexPath + ".replaced"
+	err := os.RemoveAll(replacedPath)
+	if err != nil {
+		return fmt.Errorf("error removing replaced index: %w", err)
+	}
+	err = os.Rename(indexPath, replacedPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error moving bleve index: %w", err)
+	}
+	err = os.Rename(buildPath, indexPath)
+	if err != nil {
+		os.Rename(replacedPath, indexPath)
+		return fmt.Errorf("error replacing bleve index: %w", err)
+	}
+
+	err = i.connections.Remove(indexPath)
+	if err != nil {
+		runtime.LogErrorf(i.ctx, "%s: Error closing bleve index \"%s\"\n%s", job.kind, indexPath, err)
+	}
+	i.closeGlobalMember(indexPath)
+	err = os.RemoveAll(replacedPath)
+	if err != nil {
+		runtime.LogErrorf(i.ctx, "%s: Error removing replaced bleve index \"%s\"\n%s", job.kind, replacedPath, err)
+	}
+	if job.kind != contentIndexJob {
+		// the new index joins global searches, as does the index of a docset indexed for the first time
+		i.syncGlobalIndex()
+	}
+	return nil
+}
+
+// newBuildIndex creates the index `job` builds at `buildPath`. Update jobs start from a copy of the existing index,
+// or of the index of a previous version of the docset, and index only the rows that changed. They start from scratch
+// when there's no index to copy, or it is of another format. Content jobs create an index of pages.
+func (i *Indexer) newBuildIndex(job *indexJob, docSet docsets.DocSet, docSetErr error, buildPath string) (bleve.Index, error) {
+	if job.kind == contentIndexJob {
+		bleveIndex, err := bleve.New(buildPath, newContentIndexMapping())
+		if err != nil {
+			return nil, fmt.Errorf("error creating bleve index: %w", err)
+		}
+		return bleveIndex, nil
+	}
+	if job.kind == updateIndexJob {
+		sourcePath := job.resolvedIndexPath
+		if _, err := os.Stat(sourcePath); os.IsNotExist(err) && docSetErr == nil {
+			sourcePath, _ = docSet.PreviousSidecarIndexPath()
+		}
+		if sourcePath != "" {
+			bleveIndex, diff, err := copyIndex(sourcePath, buildPath)
+			if err == nil {
+				job.diff = diff
+				return bleveIndex, nil
+			}
+			runtime.LogPrintf(i.ctx, "UpdateDocSetIndex: indexing \"%s\" from scratch, can't update \"%s\": %s",
+				job.indexPath, sourcePath, err)
+			if err = os.RemoveAll(buildPath); err != nil {
+				return nil, fmt.Errorf("error removing incomplete index: %w", err)
+			}
+		}
+	}
+
+	bleveIndex, err := bleve.New(buildPath, i.newBleveIndexMapping())
+	if err != nil {
+		return nil, fmt.Errorf("error creating bleve index: %w", err)
+	}
+	return bleveIndex, nil
+}
+
+// indexRows indexes every `searchIndex` row in batches of `indexBatchSize`, reporting progress after each batch. When
+// updating an index, rows whose document is already indexed with the same row id are skipped, and documents whose row
+// is gone are deleted.
+func (i *Indexer) indexRows(job *indexJob, bleveIndex bleve.Index, dbPath string, status *IndexStatusEvent) error {
+	dbConn, err := db.OpenSearchIndexDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("error opening db: %w", err)
+	}
+	defer dbConn.Close()
+
+	err = dbConn.QueryRowContext(job.ctx, "SELECT count(*) FROM searchIndex;").Scan(&status.Total)
+	if err != nil {
+		return fmt.Errorf("error counting rows: %w", err)
+	}
+	i.emitProgress(job, status)
+
+	rows, err := dbConn.QueryContext(job.ctx, "SELECT si.id, si.name, si.type, si.path FROM searchIndex si;")
+	if err != nil {
+		return fmt.Errorf("error querying db: %w", err)
+	}
+	defer rows.Close()
+
+	diff := job.diff
+	bleveBatch := bleveIndex.NewBatch()
+	for rows.Next() {
+		// every row adds at most one document, so flushing every `indexBatchSize` rows bounds the batch
+		if status.Processed > 0 && status.Processed%indexBatchSize == 0 {
+			if err = i.flushBatch(job, bleveIndex, bleveBatch, status); err != nil {
+				return err
+			}
+		}
+		status.Processed++
+
+		var docSetRow = IndexedItem{}
+		err = rows.Scan(&docSetRow.Id, &docSetRow.Name, &docSetRow.RowType, &docSetRow.Path)
+		if err != nil {
+			status.ScanErrors++
+			runtime.LogErrorf(i.ctx, "CreateDocSetIndex: Error scanning db row \"%s\"\n%s", dbPath, err)
+			continue
+		}
+
+		exists := false
+		if diff != nil {
+			documentId := docSetRow.DocumentId()
+			if diff.currentIds[documentId] {
+				continue
+			}
+			diff.currentIds[documentId] = true
+			var rowId int32
+			rowId, exists = diff.existingIds[documentId]
+			if exists && rowId == docSetRow.Id {
+				continue
+			}
+		}
+
+		err = docSetRow.Index(bleveBatch)
+		if err != nil {
+			status.IndexErrors++
+			runtime.LogErrorf(i.ctx, "CreateDocSetIndex: Error batching bleve index for \"%s\"\n%s", dbPath, err)
+			continue
+		}
+		if diff != nil && exists {
+			diff.updated++
+		} else if diff != nil {
+			diff.added++
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("error iterating db rows: %w", err)
+	}
+	if diff != nil {
+		for documentId := range diff.existingIds {
+			if !diff.currentIds[documentId] {
+				bleveBatch.Delete(documentId)
+				diff.removed++
+			}
+		}
+	}
+	return i.flushBatch(job, bleveIndex, bleveBatch, status)
+}
+
+// flushBatch writes `bleveBatch` to the index and reports progress, unless the job was cancelled.
+func (i *Indexer) flushBatch(job *indexJob, bleveIndex bleve.Index, bleveBatch *bleve.Batch, status *IndexStatusEvent) error {
+	if err := job.ctx.Err(); err != nil {
+		return err
+	}
+	err := bleveIndex.Batch(bleveBatch)
+	if err != nil {
+		return fmt.Errorf("error executing bleve batch: %w", err)
+	}
+	bleveBatch.Reset()
+	i.emitProgress(job, status)
+	return nil
+}
+
+func (i *Indexer) emitProgress(job *indexJob, status *IndexStatusEvent) {
+	runtime.EventsEmit(i.ctx, progressEventName, IndexProgressEvent{
+		JobId:     job.id,
+		IndexPath: job.indexPath,
+		Processed: status.Processed,
+		Total:     status.Total,
+	})
+}
@@ -0,0 +1,168 @@
+package indexer
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2/search"
+	"refi/backend/query"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Search hit clauses
+const (
+	// ClauseMatch hits contain the words of the term
+	ClauseMatch = "match"
+	// ClauseRegexp hits contain the words of the term in order, but only as parts of words
+	ClauseRegexp = "regexp"
+	// ClauseBoth hits matched both clauses
+	ClauseBoth = "both"
+	// ClauseSynonym hits only contain the words of synonyms of the term, see `query.WithSynonyms`
+	ClauseSynonym = "synonym"
+	// ClauseName hits only matched the `^prefix` or `=exact` operators
+	ClauseName = "name"
+)
+
+// MatchRange
+// Byte range of a match within a name, `End` is exclusive.
+type MatchRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// regexpPattern is the pattern of the regexp clause of a search for `term`, matching terms that contain the words of
+// `term` in order. The words are matched literally, any regexp syntax in them is escaped.
+func regexpPattern(term string) string {
+	splitTerms := strings.Fields(strings.ToLower(term))
+	for index, splitTerm := range splitTerms {
+		splitTerms[index] = regexp.QuoteMeta(splitTerm)
+	}
+	updatedTerm := strings.Join(splitTerms, ".*")
+	return fmt.Sprintf(".{0}%s.*", updatedTerm)
+}
+
+// clauseMatcher works out which query clauses matched a hit from the terms it matched. Bleve reports the matched terms
+// and their locations, but not which query they matched.
+type clauseMatcher struct {
+	// matchTerms are the terms of the match clause, the term as analyzed by the identifier analyzer
+	matchTerms map[string]bool
+	regexp     *regexp.Regexp
+	// synonymTerms are the terms of the expansions of the query that aren't terms of the term itself
+	synonymTerms map[string]bool
+	// prefix and exact are the lower cased operands of the `^prefix` and `=exact` operators
+	prefix string
+	exact  string
+}
+
+func newClauseMatcher(searchQuery query.Query) clauseMatcher {
+	matcher := clauseMatcher{
+		matchTerms:   identifierTerms(searchQuery.Term),
+		synonymTerms: map[string]bool{},
+		prefix:       strings.ToLower(searchQuery.Prefix),
+		exact:        strings.ToLower(searchQuery.Exact),
+	}
+	// phrases are matched word by word as well
+	for _, phrase := range searchQuery.Phrases {
+		for term := range identifierTerms(phrase) {
+			matcher.matchTerms[term] = true
+		}
+	}
+	// bleve regexps match whole terms
+	if searchQuery.Term != "" {
+		matcher.regexp, _ = regexp.Compile("^(?:" + regexpPattern(searchQuery.Term) + ")$")
+	}
+	for _, expansion := range searchQuery.Expansions {
+		for term := range identifierTerms(expansion) {
+			if !matcher.matchTerms[term] {
+				matcher.synonymTerms[term] = true
+			}
+		}
+	}
+	return matcher
+}
+
+// identifierTerms are the terms of `text` as analyzed by the identifier analyzer.
+func identifierTerms(text string) map[string]bool {
+	terms := map[string]bool{}
+	for _, token := range (&identifierTokenizer{}).Tokenize([]byte(text)) {
+		terms[strings.ToLower(string(token.Term))] = true
+	}
+	return terms
+}
+
+func (m clauseMatcher) searchHit(hit *search.DocumentMatch) SearchHit {
+	searchHit := SearchHit{IndexedItem: indexedItemFromHit(hit), Score: hit.Score, Matches: []MatchRange{}}
+
+	var matchRanges, regexpRanges, synonymRanges []MatchRange
+	for term, locations := range hit.Locations["name"] {
+		var ranges *[]MatchRange
+		switch {
+		case m.matchTerms[term]:
+			ranges = &matchRanges
+		case m.regexp != nil && m.regexp.MatchString(term):
+			ranges = &regexpRanges
+		case m.synonymTerms[term]:
+			ranges = &synonymRanges
+		default:
+			continue
+		}
+		for _, location := range locations {
+			*ranges = append(*ranges, MatchRange{Start: int(location.Start), End: int(location.End)})
+		}
+	}
+
+	// `^prefix` and `=exact` match the start or the whole of the name, rather than terms
+	var nameRanges []MatchRange
+	lowerName := strings.ToLower(searchHit.Name)
+	if m.exact != "" && lowerName == m.exact {
+		nameRanges = append(nameRanges, MatchRange{Start: 0, End: len(searchHit.Name)})
+	} else if m.prefix != "" && strings.HasPrefix(lowerName, m.prefix) {
+		nameRanges = append(nameRanges, MatchRange{Start: 0, End: len(m.prefix)})
+	}
+
+	switch {
+	case len(matchRanges) > 0 && len(regexpRanges) > 0:
+		searchHit.Clause = ClauseBoth
+	case len(matchRanges) > 0:
+		searchHit.Clause = ClauseMatch
+	case len(regexpRanges) > 0:
+		searchHit.Clause = ClauseRegexp
+	case len(synonymRanges) > 0:
+		searchHit.Clause = ClauseSynonym
+	case len(nameRanges) > 0:
+		searchHit.Clause = ClauseName
+	}
+
+	// regexp matches cover whole names, the words matched by the match clause are more precise
+	var ranges []MatchRange
+	if len(matchRanges) > 0 {
+		ranges = matchRanges
+	} else if len(regexpRanges) > 0 {
+		ranges = regexpRanges
+	} else {
+		ranges = synonymRanges
+	}
+	if ranges = append(ranges, nameRanges...); len(ranges) > 0 {
+		searchHit.Matches = mergeRanges(ranges)
+	}
+	return searchHit
+}
+
+// mergeRanges orders ranges, merging those that overlap or touch.
+func mergeRanges(ranges []MatchRange) []MatchRange {
+	sort.Slice(ranges, func(a, b int) bool {
+		return ranges[a].Start < ranges[b].Start
+	})
+	merged := []MatchRange{ranges[0]}
+	for _, matchRange := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if matchRange.Start <= last.End {
+			if matchRange.End > last.End {
+				last.End = matchRange.End
+			}
+			continue
+		}
+		merged = append(merged, matchRange)
+	}
+	return merged
+}
@@ -0,0 +1,61 @@
+package indexer
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"refi/backend"
+)
+
+// CheckIndex
+// Verifies the bleve index at `indexPath` can be opened and searched, returning the problem found when it can't.
+func (i *Indexer) CheckIndex(indexPath string) string {
+	bleveIndex, release, err := i.openIndex(indexPath)
+	if err != nil {
+		message := fmt.Sprintf("CheckIndex: Error opening bleve index \"%s\"\n%s", indexPath, err)
+		runtime.LogErrorf(i.ctx, message)
+		return message
+	}
+	defer release()
+
+	_, err = bleveIndex.DocCount()
+	if err != nil {
+		message := fmt.Sprintf("CheckIndex: Error counting documents in bleve index \"%s\"\n%s", indexPath, err)
+		runtime.LogErrorf(i.ctx, message)
+		return message
+	}
+
+	_, err = bleveIndex.Search(bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 1, 0, false))
+	if err != nil {
+		message := fmt.Sprintf("CheckIndex: Error searching bleve index \"%s\"\n%s", indexPath, err)
+		runtime.LogErrorf(i.ctx, message)
+		return message
+	}
+
+	return ""
+}
+
+type QuarantineIndexResult struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// QuarantineIndex
+// Closes the corrupt bleve index at `indexPath` and moves it aside, so it can be rebuilt. `Path` is where it was moved
+// to.
+func (i *Indexer) QuarantineIndex(indexPath string) QuarantineIndexResult {
+	err := i.connections.Remove(indexPath)
+	if err != nil {
+		runtime.LogErrorf(i.ctx, "QuarantineIndex: Error closing bleve index \"%s\"\n%s", indexPath, err)
+	}
+
+	quarantinePath, err := backend.Quarantine(indexPath)
+	if err != nil {
+		message := fmt.Sprintf("QuarantineIndex: Error moving bleve index \"%s\"\n%s", indexPath, err)
+		runtime.LogErrorf(i.ctx, message)
+		return QuarantineIndexResult{Error: message}
+	}
+
+	runtime.LogPrintf(i.ctx, "QuarantineIndex: moved \"%s\" to \"%s\".", indexPath, quarantinePath)
+	return QuarantineIndexResult{Path: quarantinePath}
+}
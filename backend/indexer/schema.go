@@ -0,0 +1,152 @@
+package indexer
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"os"
+	"refi/backend/docsets"
+	"strconv"
+	"sync"
+)
+
+// indexFormatVersion is the version of the docset index mapping, bump it whenever `newBleveIndexMapping` changes so
+// existing indexes are rebuilt
+const indexFormatVersion = 2
+
+// index metadata, stored with bleve's internal key/values so it lives and dies with the index
+var (
+	formatVersionKey = []byte("refi.formatVersion")
+	docSetVersionKey = []byte("refi.docSetVersion")
+)
+
+// indexMetadata
+// The versions an index was built with. Indexes created before versions were recorded have neither.
+type indexMetadata struct {
+	FormatVersion int
+	DocSetVersion string
+}
+
+var (
+	// scheduledRebuilds are the indexes being rebuilt or updated automatically, failed and cancelled rebuilds are retried the next
+	// time the index is opened
+	scheduledRebuilds   = map[string]bool{}
+	scheduledRebuildsMu sync.Mutex
+)
+
+func readIndexMetadata(bleveIndex bleve.Index) (indexMetadata, error) {
+	var metadata indexMetadata
+	formatVersion, err := bleveIndex.GetInternal(formatVersionKey)
+	if err != nil {
+		return metadata, err
+	}
+	if formatVersion != nil {
+		metadata.FormatVersion, _ = strconv.Atoi(string(formatVersion))
+	}
+	docSetVersion, err := bleveIndex.GetInternal(docSetVersionKey)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.DocSetVersion = string(docSetVersion)
+	return metadata, nil
+}
+
+// writeIndexMetadata records that the index is in the current format, and holds the entries of `docSetVersion`.
+func writeIndexMetadata(bleveIndex bleve.Index, docSetVersion string) error {
+	err := bleveIndex.SetInternal(formatVersionKey, []byte(strconv.Itoa(indexFormatVersion)))
+	if err != nil {
+		return err
+	}
+	return bleveIndex.SetInternal(docSetVersionKey, []byte(docSetVersion))
+}
+
+// checkIndexSchema schedules a rebuild of the index at `indexPath`, as it is opened, when it was built with an older
+// mapping. The stale index keeps serving searches until the rebuilt index replaces it. Indexes that don't belong to an
+// installed docset are left alone, as there's nothing to rebuild them from. Docset versions aren't checked, the
+// version is part of the sidecar path so a new version of a docset never opens the index of another, see
+// `servedIndexPath`.
+func (i *Indexer) checkIndexSchema(indexPath string, bleveIndex bleve.Index) {
+	docSet, ok := installedDocSetForIndex(indexPath)
+	if !ok {
+		return
+	}
+
+	metadata, err := readIndexMetadata(bleveIndex)
+	if err != nil {
+		runtime.LogErrorf(i.ctx, "checkIndexSchema: Error reading index metadata \"%s\"\n%s", indexPath, err)
+		return
+	}
+	if metadata.FormatVersion == indexFormatVersion {
+		return
+	}
+
+	if i.scheduleIndexJob(docSet, createIndexJob) {
+		runtime.LogPrintf(i.ctx, fmt.Sprintf("checkIndexSchema: rebuilding stale index \"%s\", format %d (current %d).",
+			indexPath, metadata.FormatVersion, indexFormatVersion))
+	}
+}
+
+// servedIndexPath returns the index that serves searches of the index at `indexPath`. Until a docset that was updated
+// has an index of its own, the index of its previous version serves searches, while an update job brings it up to
+// date in the background, see `UpdateDocSetIndex`.
+func (i *Indexer) servedIndexPath(indexPath string) string {
+	if _, err := os.Stat(indexPath); !os.IsNotExist(err) {
+		return indexPath
+	}
+	docSet, ok := installedDocSetForIndex(indexPath)
+	if !ok {
+		return indexPath
+	}
+	previousPath, ok := docSet.PreviousSidecarIndexPath()
+	if !ok {
+		return indexPath
+	}
+
+	if i.scheduleIndexJob(docSet, updateIndexJob) {
+		runtime.LogPrintf(i.ctx, fmt.Sprintf("servedIndexPath: updating \"%s\" from \"%s\".", indexPath, previousPath))
+	}
+	return previousPath
+}
+
+// scheduleIndexJob runs a job of `kind` on the index of `docSet` in the background, unless one is already scheduled
+// or another job is indexing it. Reports whether the job was scheduled.
+func (i *Indexer) scheduleIndexJob(docSet docsets.DocSet, kind indexJobKind) bool {
+	indexPath := docSet.SidecarIndexPath()
+	scheduledRebuildsMu.Lock()
+	if scheduledRebuilds[indexPath] {
+		scheduledRebuildsMu.Unlock()
+		return false
+	}
+	scheduledRebuilds[indexPath] = true
+	scheduledRebuildsMu.Unlock()
+
+	job, err := i.newIndexJob(indexPath)
+	if err != nil {
+		// already being indexed, the index is checked again once it is reopened
+		unscheduleRebuild(indexPath)
+		return false
+	}
+	job.kind = kind
+	go func() {
+		i.runIndexJob(job, docSet.DBPath())
+		unscheduleRebuild(indexPath)
+	}()
+	return true
+}
+
+func unscheduleRebuild(indexPath string) {
+	scheduledRebuildsMu.Lock()
+	defer scheduledRebuildsMu.Unlock()
+
+	delete(scheduledRebuilds, indexPath)
+}
+
+// installedDocSetForIndex returns the installed docset whose sidecar index is at `indexPath`.
+func installedDocSetForIndex(indexPath string) (docsets.DocSet, bool) {
+	for _, docSet := range docsets.Installed() {
+		if docSet.SidecarIndexPath() == indexPath {
+			return docSet, true
+		}
+	}
+	return docsets.DocSet{}, false
+}
@@ -0,0 +1,145 @@
+package indexer
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// UpdateDocSetIndex
+// Brings the bleve index of a docset up to date with its `searchIndex` table, only adding entries that are new and
+// deleting entries that are gone, which is much quicker than `CreateDocSetIndex` after a docset update. Entries whose
+// `searchIndex` row id changed are indexed again, so hits keep returning the current row ids. When the current docset
+// version has no index yet, the index of the previous version is updated instead. Without any index to update, or when
+// the index is of an older format, the index is created from scratch.
+//
+// Like `CreateDocSetIndex`, the update is made to a copy of the index that replaces it once complete, progress is
+// reported with `indexer|progress` events and the outcome with an `indexer|status` event, the job can be cancelled
+// with `CancelIndexJob`, and only one job can index a docset at a time.
+func (i *Indexer) UpdateDocSetIndex(indexPath string, dbPath string) string {
+	job, err := i.newIndexJob(indexPath)
+	if err != nil {
+		message := fmt.Sprintf("UpdateDocSetIndex: Error starting indexing \"%s\"\n%s", indexPath, err)
+		runtime.LogErrorf(i.ctx, message)
+		return message
+	}
+	job.kind = updateIndexJob
+
+	return i.runIndexJob(job, dbPath).Error
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+// copyIndex copies the index at `sourcePath` to `buildPath` and opens the copy, along with the documents already in it.
+// Indexes of another format can't be updated, they fail to copy.
+func copyIndex(sourcePath string, buildPath string) (bleve.Index, *indexDiff, error) {
+	err := copyDir(sourcePath, buildPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error copying index: %w", err)
+	}
+	bleveIndex, err := bleve.Open(buildPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening index: %w", err)
+	}
+
+	metadata, err := readIndexMetadata(bleveIndex)
+	if err == nil && metadata.FormatVersion != indexFormatVersion {
+		err = fmt.Errorf("index is of format %d, not %d", metadata.FormatVersion, indexFormatVersion)
+	}
+	var existingIds map[string]int32
+	if err == nil {
+		existingIds, err = documentRowIds(bleveIndex)
+	}
+	if err != nil {
+		bleveIndex.Close()
+		return nil, nil, err
+	}
+	return bleveIndex, &indexDiff{existingIds: existingIds, currentIds: map[string]bool{}}, nil
+}
+
+// copyDir copies the directory tree `sourcePath` to `destinationPath`.
+func copyDir(sourcePath string, destinationPath string) error {
+	return filepath.WalkDir(sourcePath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(sourcePath, path)
+		if err != nil {
+			return err
+		}
+		targetPath := filepath.Join(destinationPath, relativePath)
+		if entry.IsDir() {
+			return os.MkdirAll(targetPath, 0755)
+		}
+
+		source, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		target, err := os.Create(targetPath)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(target, source); err != nil {
+			target.Close()
+			return err
+		}
+		return target.Close()
+	})
+}
+
+// documentRowIds returns the ids of every document in the index, along with the `searchIndex` row id stored with it.
+func documentRowIds(bleveIndex bleve.Index) (map[string]int32, error) {
+	advancedIndex, err := bleveIndex.Advanced()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := advancedIndex.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	docIdReader, err := reader.DocIDReaderAll()
+	if err != nil {
+		return nil, err
+	}
+	defer docIdReader.Close()
+
+	documentRowIds := map[string]int32{}
+	for {
+		var internalId index.IndexInternalID
+		internalId, err = docIdReader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if internalId == nil {
+			return documentRowIds, nil
+		}
+		documentId, err := reader.ExternalID(internalId)
+		if err != nil {
+			return nil, err
+		}
+		document, err := reader.Document(documentId)
+		if err != nil {
+			return nil, err
+		}
+		// documents without a stored row id are indexed again
+		rowId := int32(-1)
+		document.VisitFields(func(field index.Field) {
+			if numericField, ok := field.(index.NumericField); ok && field.Name() == "id" {
+				if number, err := numericField.Number(); err == nil {
+					rowId = int32(number)
+				}
+			}
+		})
+		documentRowIds[documentId] = rowId
+	}
+}
@@ -0,0 +1,89 @@
+package inflight
+
+import (
+	"context"
+	"sync"
+)
+
+// tab tracks the queries of one search tab.
+type tab struct {
+	// latest is the newest query id started by the tab
+	latest  int64
+	cancels map[int64]context.CancelFunc
+}
+
+var (
+	tabs   = map[string]*tab{}
+	tabsMu sync.Mutex
+)
+
+// Start
+// Registers query `queryId` of the search tab `tabId`. Query ids increase with every query a tab sends, so starting a
+// query cancels the tabs older queries still in flight. The returned context is cancelled once a newer query of the
+// tab starts (straight away when one already has), and the returned function must be called once the query is done.
+// Queries without a tab id are never superseded.
+func Start(tabId string, queryId int64) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if tabId == "" {
+		return ctx, cancel
+	}
+
+	tabsMu.Lock()
+	defer tabsMu.Unlock()
+
+	t, ok := tabs[tabId]
+	if !ok {
+		t = &tab{cancels: map[int64]context.CancelFunc{}}
+		tabs[tabId] = t
+	}
+	if queryId < t.latest {
+		cancel()
+		return ctx, cancel
+	}
+
+	t.latest = queryId
+	for id, older := range t.cancels {
+		if id < queryId {
+			older()
+			delete(t.cancels, id)
+		}
+	}
+	t.cancels[queryId] = cancel
+
+	return ctx, func() {
+		cancel()
+		tabsMu.Lock()
+		defer tabsMu.Unlock()
+		delete(t.cancels, queryId)
+	}
+}
+
+// IsStale
+// Reports whether a newer query than `queryId` has started in the tab `tabId`, so its results would be out of date.
+func IsStale(tabId string, queryId int64) bool {
+	if tabId == "" {
+		return false
+	}
+
+	tabsMu.Lock()
+	defer tabsMu.Unlock()
+
+	t, ok := tabs[tabId]
+	return ok && queryId < t.latest
+}
+
+// CloseTab
+// Cancels the queries in flight for the tab `tabId`, and forgets it.
+func CloseTab(tabId string) {
+	tabsMu.Lock()
+	defer tabsMu.Unlock()
+
+	t, ok := tabs[tabId]
+	if !ok {
+		return
+	}
+	for _, cancel := range t.cancels {
+		cancel()
+	}
+	delete(tabs, tabId)
+}
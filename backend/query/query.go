@@ -0,0 +1,245 @@
+package query
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Filter prefixes
+const (
+	typeFilterPrefix   = "type:"
+	docSetFilterPrefix = "docset:"
+)
+
+// Operators prefixing a word or quoted phrase
+const (
+	excludeOperator = '-'
+	prefixOperator  = '^'
+	exactOperator   = '='
+)
+
+// Query
+// A search as typed by the user, split into the text to search for, the docset keyword, any filters and the words and
+// phrases given with operators, see `Parse`.
+type Query struct {
+	Keyword string   `json:"keyword"`
+	Term    string   `json:"term"`
+	Types   []string `json:"types"`
+	// DocSets are the `docset:` filters, resolved like keywords by searches across docsets
+	DocSets []string `json:"docSets"`
+	// Phrases are quoted phrases, their words must appear in the name in order
+	Phrases []string `json:"phrases"`
+	// Excluded are words and phrases that mustn't appear in the name
+	Excluded []string `json:"excluded"`
+	// Prefix is the start of the name, ignoring case
+	Prefix string `json:"prefix"`
+	// Exact is the whole name, ignoring case
+	Exact string `json:"exact"`
+	// Expansions are searched for along with the term, see `WithSynonyms`
+	Expansions []string `json:"expansions"`
+}
+
+// Parse
+// Splits a leading docset keyword, filters and operators out of `input`, the remaining words make up the term.
+//
+// A keyword prefix routes the search to docsets, eg `go:http.Client` searches for "http.Client" in the docsets with
+// the keyword "go". Whether a keyword refers to any docsets is up to the caller, see `WithoutKeyword`.
+//
+// Type filters limit the search to entry types, eg `type:func Marshal` searches for "Marshal" in entries whose type
+// starts with "func". Several types can be given comma separated (`type:class,struct`) or as separate filters.
+// `docset:` filters limit searches across docsets the same way, eg `docset:go,python`.
+//
+// Words in double quotes are a phrase (`"http client"`), and words or phrases can be given with an operator:
+// `-word` excludes names containing the word, `^word` matches names starting with it and `=word` matches the whole
+// name. Operators and quotes are taken literally, never as regular expression or LIKE patterns.
+func Parse(input string) Query {
+	var query Query
+	input = strings.TrimSpace(input)
+	if fields := strings.Fields(input); len(fields) > 0 && !isOperator(fields[0][0]) {
+		// split before tokenizing, so the keyword can be followed by a quoted phrase (`go:"http client"`)
+		if keyword, _, ok := splitKeyword(fields[0]); ok {
+			query.Keyword = keyword
+			input = input[len(keyword)+1:]
+		}
+	}
+
+	var terms []string
+	for _, token := range tokenize(input) {
+		switch {
+		case token.operator == excludeOperator:
+			query.Excluded = append(query.Excluded, token.text)
+		case token.operator == prefixOperator:
+			query.Prefix = token.text
+		case token.operator == exactOperator:
+			query.Exact = token.text
+		case token.quoted:
+			query.Phrases = append(query.Phrases, token.text)
+		case isFilter(token.text, typeFilterPrefix):
+			query.Types = append(query.Types, splitFilter(token.text, typeFilterPrefix)...)
+		case isFilter(token.text, docSetFilterPrefix):
+			query.DocSets = append(query.DocSets, splitFilter(token.text, docSetFilterPrefix)...)
+		default:
+			terms = append(terms, token.text)
+		}
+	}
+	query.Term = strings.Join(terms, " ")
+	return query
+}
+
+// IsEmpty
+// Reports whether the query has nothing to match names against, filters and exclusions on their own match nothing.
+func (q Query) IsEmpty() bool {
+	return q.Term == "" && len(q.Phrases) == 0 && q.Prefix == "" && q.Exact == ""
+}
+
+// WithoutKeyword
+// Returns a copy of the query searching for the keyword prefix as part of the term, for when the keyword doesn't
+// refer to any docsets (eg `std::vector`).
+func (q Query) WithoutKeyword() Query {
+	if q.Keyword == "" {
+		return q
+	}
+	q.Term = q.Keyword + ":" + q.Term
+	q.Keyword = ""
+	return q
+}
+
+// WithTypes
+// Returns a copy of the query also filtering by `types`.
+func (q Query) WithTypes(types []string) Query {
+	q.Types = append(append([]string{}, q.Types...), types...)
+	return q
+}
+
+// TypeCount
+// Number of search hits, or entries, of a given type.
+type TypeCount struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+// SortTypeCounts
+// Orders type counts by count, most common first, then by type.
+func SortTypeCounts(typeCounts []TypeCount) {
+	sort.Slice(typeCounts, func(i, j int) bool {
+		if typeCounts[i].Count != typeCounts[j].Count {
+			return typeCounts[i].Count > typeCounts[j].Count
+		}
+		return typeCounts[i].Type < typeCounts[j].Type
+	})
+}
+
+// ResolveTypes
+// Maps type filters to the entry types available in a docset. A filter matches every type it is a case-insensitive
+// prefix of, so "func" matches "Function".
+func ResolveTypes(filters []string, available []TypeCount) []string {
+	var types []string
+	for _, typeCount := range available {
+		for _, filter := range filters {
+			if strings.HasPrefix(strings.ToLower(typeCount.Type), strings.ToLower(filter)) {
+				types = append(types, typeCount.Type)
+				break
+			}
+		}
+	}
+	return types
+}
+
+func isFilter(field string, prefix string) bool {
+	return len(field) > len(prefix) && strings.EqualFold(field[:len(prefix)], prefix)
+}
+
+// splitFilter splits the comma separated values of a filter.
+func splitFilter(field string, prefix string) []string {
+	var values []string
+	for _, value := range strings.Split(field[len(prefix):], ",") {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// token is a whitespace separated word or a quoted phrase of a query, along with the operator it is prefixed with.
+type token struct {
+	text     string
+	quoted   bool
+	operator byte
+}
+
+// tokenize splits `input` into words and quoted phrases. An unterminated quote runs to the end of the input, and an
+// operator on its own is taken as a word.
+func tokenize(input string) []token {
+	var tokens []token
+	for offset := 0; offset < len(input); {
+		r, size := utf8.DecodeRuneInString(input[offset:])
+		if unicode.IsSpace(r) {
+			offset += size
+			continue
+		}
+
+		var current token
+		if isOperator(input[offset]) && offset+1 < len(input) {
+			next, _ := utf8.DecodeRuneInString(input[offset+1:])
+			if !unicode.IsSpace(next) {
+				current.operator = input[offset]
+				offset++
+			}
+		}
+
+		if input[offset] == '"' {
+			current.quoted = true
+			end := strings.IndexByte(input[offset+1:], '"')
+			if end < 0 {
+				current.text = input[offset+1:]
+				offset = len(input)
+			} else {
+				current.text = input[offset+1 : offset+1+end]
+				offset += end + 2
+			}
+			current.text = strings.Join(strings.Fields(current.text), " ")
+			if current.text == "" {
+				continue
+			}
+		} else {
+			end := offset
+			for end < len(input) {
+				r, size := utf8.DecodeRuneInString(input[end:])
+				if unicode.IsSpace(r) {
+					break
+				}
+				end += size
+			}
+			current.text = input[offset:end]
+			offset = end
+		}
+		tokens = append(tokens, current)
+	}
+	return tokens
+}
+
+func isOperator(char byte) bool {
+	return char == excludeOperator || char == prefixOperator || char == exactOperator
+}
+
+// splitKeyword splits `go:http.Client` into "go" and "http.Client". Filters and scope operators (`std::vector`) aren't
+// keywords.
+func splitKeyword(field string) (string, string, bool) {
+	index := strings.Index(field, ":")
+	name := field[:index+1]
+	if index <= 0 || strings.EqualFold(name, typeFilterPrefix) || strings.EqualFold(name, docSetFilterPrefix) {
+		return "", "", false
+	}
+	rest := field[index+1:]
+	if strings.HasPrefix(rest, ":") {
+		return "", "", false
+	}
+	for _, r := range field[:index] {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_-.+#", r) {
+			return "", "", false
+		}
+	}
+	return field[:index], rest, true
+}
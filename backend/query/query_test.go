@@ -0,0 +1,66 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Query
+	}{
+		{"", Query{}},
+		{"  http   client ", Query{Term: "http client"}},
+		{`"http client" get`, Query{Term: "get", Phrases: []string{"http client"}}},
+		{`"unterminated  phrase`, Query{Phrases: []string{"unterminated phrase"}}},
+		{`"" x`, Query{Term: "x"}},
+		{"-deprecated Marshal", Query{Term: "Marshal", Excluded: []string{"deprecated"}}},
+		{`-"old api" x`, Query{Term: "x", Excluded: []string{"old api"}}},
+		{"^Json", Query{Prefix: "Json"}},
+		{`^"http cl"`, Query{Prefix: "http cl"}},
+		{"=String", Query{Exact: "String"}},
+		{"type:func,method Marshal", Query{Term: "Marshal", Types: []string{"func", "method"}}},
+		{"TYPE:class type:struct,", Query{Types: []string{"class", "struct"}}},
+		{"type:", Query{Term: "type:"}},
+		{"docset:go,python Client", Query{Term: "Client", DocSets: []string{"go", "python"}}},
+		{"go:http.Client", Query{Keyword: "go", Term: "http.Client"}},
+		{`go:"http client"`, Query{Keyword: "go", Phrases: []string{"http client"}}},
+		{"std::vector", Query{Term: "std::vector"}},
+		{"-go:x", Query{Excluded: []string{"go:x"}}},
+		// operators on their own are words
+		{"- x", Query{Term: "- x"}},
+		{"x ^", Query{Term: "x ^"}},
+		{"=", Query{Term: "="}},
+		// regular expression and LIKE syntax is taken literally
+		{"a.*b (c) [d]", Query{Term: "a.*b (c) [d]"}},
+		{"100%_done", Query{Term: "100%_done"}},
+	}
+	for _, test := range tests {
+		got := Parse(test.input)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"", true},
+		{"type:func", true},
+		{"-x", true},
+		{"docset:go -x", true},
+		{"x", false},
+		{`"x"`, false},
+		{"^x", false},
+		{"=x", false},
+	}
+	for _, test := range tests {
+		if got := Parse(test.input).IsEmpty(); got != test.want {
+			t.Errorf("Parse(%q).IsEmpty() = %t, want %t", test.input, got, test.want)
+		}
+	}
+}
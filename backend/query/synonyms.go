@@ -0,0 +1,316 @@
+package query
+
+import (
+	"slices"
+	"strings"
+)
+
+// SynonymWeight
+// Weight of the terms a query is expanded with, relative to the term as typed.
+const SynonymWeight = 0.5
+
+// maxExpansions caps the terms a query is expanded with, so a term made of many common words stays cheap to search.
+const maxExpansions = 16
+
+// commonSynonyms are searched for in every docset, unless its platform family has synonyms of its own for the word.
+var commonSynonyms = map[string][]string{
+	"len":      {"length", "size", "count"},
+	"length":   {"len", "size", "count"},
+	"size":     {"len", "length", "count"},
+	"count":    {"len", "length", "size"},
+	"str":      {"string"},
+	"string":   {"str"},
+	"dict":     {"map", "hash"},
+	"map":      {"dict", "hash"},
+	"hash":     {"dict", "map"},
+	"list":     {"array", "vector"},
+	"array":    {"list", "vector"},
+	"vector":   {"array", "list"},
+	"func":     {"function"},
+	"function": {"func"},
+	"fn":       {"function"},
+	"int":      {"integer"},
+	"integer":  {"int"},
+	"bool":     {"boolean"},
+	"boolean":  {"bool"},
+	"err":      {"error"},
+	"error":    {"err", "exception"},
+	"del":      {"delete", "remove"},
+	"delete":   {"remove"},
+	"remove":   {"delete"},
+	"append":   {"push", "add"},
+	"push":     {"append", "add"},
+}
+
+// platformSynonyms map the vocabulary of other ecosystems to the names used by a `DocSetPlatformFamily`, eg a search
+// for "length" in a Python docset also searches for "len".
+var platformSynonyms = map[string]map[string][]string{
+	"python": {
+		"length":  {"len"},
+		"size":    {"len"},
+		"count":   {"len"},
+		"map":     {"dict"},
+		"hash":    {"dict"},
+		"object":  {"dict"},
+		"array":   {"list"},
+		"vector":  {"list"},
+		"slice":   {"list"},
+		"string":  {"str"},
+		"push":    {"append"},
+		"add":     {"append"},
+		"boolean": {"bool"},
+		"integer": {"int"},
+		"delete":  {"del", "remove"},
+		"error":   {"exception"},
+		"null":    {"None"},
+		"nil":     {"None"},
+	},
+	"javascript": {
+		"len":     {"length"},
+		"size":    {"length"},
+		"count":   {"length"},
+		"dict":    {"Map", "object"},
+		"hash":    {"Map", "object"},
+		"list":    {"Array"},
+		"vector":  {"Array"},
+		"slice":   {"Array"},
+		"str":     {"String"},
+		"append":  {"push"},
+		"add":     {"push"},
+		"bool":    {"Boolean"},
+		"int":     {"Number"},
+		"integer": {"Number"},
+		"float":   {"Number"},
+		"del":     {"delete"},
+		"remove":  {"delete", "splice"},
+		"err":     {"Error"},
+		"nil":     {"null"},
+		"None":    {"null"},
+	},
+	"go": {
+		"length":    {"len"},
+		"size":      {"len"},
+		"count":     {"len"},
+		"dict":      {"map"},
+		"hash":      {"map"},
+		"list":      {"slice"},
+		"array":     {"slice"},
+		"vector":    {"slice"},
+		"str":       {"string"},
+		"push":      {"append"},
+		"add":       {"append"},
+		"boolean":   {"bool"},
+		"integer":   {"int"},
+		"del":       {"delete"},
+		"remove":    {"delete"},
+		"function":  {"func"},
+		"exception": {"error"},
+		"null":      {"nil"},
+		"None":      {"nil"},
+	},
+	"rust": {
+		"length":    {"len"},
+		"size":      {"len"},
+		"count":     {"len"},
+		"dict":      {"HashMap"},
+		"map":       {"HashMap"},
+		"hash":      {"HashMap"},
+		"list":      {"Vec"},
+		"array":     {"Vec"},
+		"vector":    {"Vec"},
+		"str":       {"String"},
+		"append":    {"push"},
+		"add":       {"push"},
+		"boolean":   {"bool"},
+		"integer":   {"i32", "i64"},
+		"del":       {"remove"},
+		"delete":    {"remove"},
+		"function":  {"fn"},
+		"func":      {"fn"},
+		"exception": {"Error", "Result"},
+		"null":      {"None", "Option"},
+		"nil":       {"None", "Option"},
+	},
+	"java": {
+		"len":      {"size", "length"},
+		"length":   {"size"},
+		"count":    {"size"},
+		"dict":     {"Map", "HashMap"},
+		"map":      {"Map", "HashMap"},
+		"hash":     {"HashMap"},
+		"list":     {"List", "ArrayList"},
+		"array":    {"ArrayList"},
+		"vector":   {"ArrayList"},
+		"slice":    {"subList"},
+		"str":      {"String"},
+		"append":   {"add"},
+		"push":     {"add"},
+		"bool":     {"boolean"},
+		"int":      {"Integer"},
+		"del":      {"remove"},
+		"delete":   {"remove"},
+		"function": {"method"},
+		"func":     {"method"},
+		"err":      {"Exception"},
+		"error":    {"Exception"},
+		"nil":      {"null"},
+		"None":     {"null"},
+	},
+	"cpp": {
+		"len":     {"size"},
+		"length":  {"size"},
+		"count":   {"size"},
+		"dict":    {"map", "unordered_map"},
+		"hash":    {"unordered_map"},
+		"list":    {"vector"},
+		"array":   {"vector"},
+		"slice":   {"span"},
+		"str":     {"string"},
+		"append":  {"push_back"},
+		"push":    {"push_back"},
+		"add":     {"push_back", "insert"},
+		"boolean": {"bool"},
+		"integer": {"int"},
+		"del":     {"erase"},
+		"delete":  {"erase"},
+		"remove":  {"erase"},
+		"err":     {"exception"},
+		"error":   {"exception"},
+		"null":    {"nullptr"},
+		"nil":     {"nullptr"},
+		"None":    {"nullptr"},
+	},
+	"ruby": {
+		"len":      {"length", "size"},
+		"count":    {"length", "size"},
+		"dict":     {"Hash"},
+		"map":      {"Hash"},
+		"list":     {"Array"},
+		"vector":   {"Array"},
+		"slice":    {"Array"},
+		"str":      {"String"},
+		"append":   {"push"},
+		"add":      {"push"},
+		"bool":     {"TrueClass", "FalseClass"},
+		"int":      {"Integer"},
+		"del":      {"delete"},
+		"remove":   {"delete"},
+		"function": {"method"},
+		"func":     {"method"},
+		"err":      {"Exception"},
+		"error":    {"Exception"},
+		"null":     {"nil"},
+		"None":     {"nil"},
+	},
+	"swift": {
+		"len":       {"count"},
+		"length":    {"count"},
+		"size":      {"count"},
+		"dict":      {"Dictionary"},
+		"map":       {"Dictionary"},
+		"hash":      {"Dictionary"},
+		"list":      {"Array"},
+		"vector":    {"Array"},
+		"slice":     {"ArraySlice"},
+		"str":       {"String"},
+		"push":      {"append"},
+		"add":       {"append", "insert"},
+		"bool":      {"Bool"},
+		"boolean":   {"Bool"},
+		"int":       {"Int"},
+		"integer":   {"Int"},
+		"del":       {"remove"},
+		"delete":    {"remove"},
+		"function":  {"func"},
+		"exception": {"Error"},
+		"null":      {"nil"},
+		"None":      {"nil"},
+	},
+	"php": {
+		"len":    {"strlen", "count"},
+		"length": {"strlen", "count"},
+		"size":   {"count"},
+		"dict":   {"array"},
+		"map":    {"array"},
+		"hash":   {"array"},
+		"list":   {"array"},
+		"vector": {"array"},
+		"slice":  {"array_slice"},
+		"str":    {"string"},
+		"append": {"array_push"},
+		"push":   {"array_push"},
+		"del":    {"unset"},
+		"delete": {"unset"},
+		"remove": {"unset"},
+		"func":   {"function"},
+		"fn":     {"function"},
+		"err":    {"Exception"},
+		"error":  {"Exception"},
+		"nil":    {"null"},
+		"None":   {"null"},
+	},
+}
+
+// platformFamilyAliases are the other `DocSetPlatformFamily` values docsets use for the families above.
+var platformFamilyAliases = map[string]string{
+	"python2":    "python",
+	"python3":    "python",
+	"js":         "javascript",
+	"node":       "javascript",
+	"nodejs":     "javascript",
+	"typescript": "javascript",
+	"golang":     "go",
+	"c++":        "cpp",
+	"cplusplus":  "cpp",
+	"ios":        "swift",
+	"macosx":     "swift",
+}
+
+// Synonyms
+// Returns the synonyms to search for in docsets of `platformFamily`: the common synonyms, with the built-in synonyms of
+// the platform family replacing those of the same word, extended with `custom` (eg the `synonyms` setting). Words are
+// looked up ignoring case.
+func Synonyms(platformFamily string, custom map[string][]string) map[string][]string {
+	family := strings.ToLower(platformFamily)
+	if alias, ok := platformFamilyAliases[family]; ok {
+		family = alias
+	}
+
+	synonyms := map[string][]string{}
+	for _, words := range []map[string][]string{commonSynonyms, platformSynonyms[family]} {
+		for word, wordSynonyms := range words {
+			synonyms[strings.ToLower(word)] = wordSynonyms
+		}
+	}
+	for word, wordSynonyms := range custom {
+		word = strings.ToLower(word)
+		// clipped so appending never writes to the built-in tables
+		synonyms[word] = append(slices.Clip(synonyms[word]), wordSynonyms...)
+	}
+	return synonyms
+}
+
+// WithSynonyms
+// Returns a copy of the query also searching for the term with a word replaced by one of its `synonyms`, eg "dict
+// keys" is expanded with "map keys". Expansions are weighted lower than the term, see `SynonymWeight`.
+func (q Query) WithSynonyms(synonyms map[string][]string) Query {
+	q.Expansions = nil
+	seen := map[string]bool{strings.ToLower(q.Term): true}
+	words := strings.Fields(q.Term)
+	for index, word := range words {
+		for _, synonym := range synonyms[strings.ToLower(word)] {
+			expanded := make([]string, 0, len(words))
+			expanded = append(append(append(expanded, words[:index]...), synonym), words[index+1:]...)
+			expansion := strings.Join(expanded, " ")
+			if seen[strings.ToLower(expansion)] {
+				continue
+			}
+			seen[strings.ToLower(expansion)] = true
+			q.Expansions = append(q.Expansions, expansion)
+			if len(q.Expansions) == maxExpansions {
+				return q
+			}
+		}
+	}
+	return q
+}
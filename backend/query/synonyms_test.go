@@ -0,0 +1,42 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSynonyms(t *testing.T) {
+	custom := map[string][]string{"Len": {"sz"}, "widget": {"gadget"}}
+	tests := []struct {
+		platformFamily string
+		word           string
+		want           []string
+	}{
+		// platform synonyms win over the common synonyms of the same word
+		{"python", "length", []string{"len"}},
+		{"python3", "dict", []string{"map", "hash"}},
+		// common synonyms of words the platform has none for are kept
+		{"python", "func", []string{"function"}},
+		{"go", "fn", []string{"function"}},
+		{"python", "none", nil},
+		{"javascript", "none", []string{"null"}},
+		// families without synonyms of their own get the common synonyms
+		{"", "length", []string{"len", "size", "count"}},
+		{"haskell", "str", []string{"string"}},
+		// custom synonyms extend the built-in ones
+		{"go", "len", []string{"length", "size", "count", "sz"}},
+		{"javascript", "len", []string{"length", "sz"}},
+		{"", "widget", []string{"gadget"}},
+	}
+	for _, test := range tests {
+		got := Synonyms(test.platformFamily, custom)[test.word]
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Synonyms(%q)[%q] = %v, want %v", test.platformFamily, test.word, got, test.want)
+		}
+	}
+
+	// extending with custom synonyms leaves the built-in tables alone
+	if got := Synonyms("go", nil)["len"]; !reflect.DeepEqual(got, []string{"length", "size", "count"}) {
+		t.Errorf("Synonyms(%q)[%q] = %v after adding custom synonyms", "go", "len", got)
+	}
+}
@@ -0,0 +1,332 @@
+package registry
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Registry
+// Keeps track of open handles (sqlite connections, bleve indexes, etc) that are shared between concurrent callers.
+// Handles are reference counted while in use, and handles nobody is using are closed once the registry grows past
+// `maxOpen` (least recently used first), or once they have been idle for longer than `idleTimeout`. Pinned handles
+// don't count towards `maxOpen`, see `Pin`.
+type Registry[T io.Closer] struct {
+	mu          sync.Mutex
+	entries     map[string]*entry[T]
+	lru         *list.List
+	maxOpen     int
+	idleTimeout time.Duration
+	done        chan struct{}
+	closed      bool
+}
+
+type entry[T io.Closer] struct {
+	key      string
+	handle   T
+	err      error
+	ready    chan struct{}
+	refs     int
+	pins     int
+	lastUsed time.Time
+	element  *list.Element
+	removed  bool
+}
+
+type OpenFunc[T io.Closer] func() (T, error)
+
+type ReleaseFunc func()
+
+func New[T io.Closer](maxOpen int, idleTimeout time.Duration) *Registry[T] {
+	r := &Registry[T]{
+		entries:     map[string]*entry[T]{},
+		lru:         list.New(),
+		maxOpen:     maxOpen,
+		idleTimeout: idleTimeout,
+		done:        make(chan struct{}),
+	}
+	if idleTimeout > 0 {
+		go r.evictIdle()
+	}
+	return r
+}
+
+// Acquire
+// Returns the handle registered under `key`, opening it with `open` if it isn't open yet. The returned release
+// function must be called once the caller is done with the handle.
+func (r *Registry[T]) Acquire(key string, open OpenFunc[T]) (T, ReleaseFunc, error) {
+	var zero T
+	e, err := r.acquire(key, open, false)
+	if err != nil {
+		return zero, nil, err
+	}
+	return e.handle, r.releaseFunc(e, false), nil
+}
+
+// Pin
+// `Acquire` for handles held for long periods, eg the members of a long-lived index alias. Until it is released, the
+// handle doesn't count towards `maxOpen`, so it doesn't crowd out the handles of other callers, which still share it.
+func (r *Registry[T]) Pin(key string, open OpenFunc[T]) (T, ReleaseFunc, error) {
+	var zero T
+	e, err := r.acquire(key, open, true)
+	if err != nil {
+		return zero, nil, err
+	}
+	return e.handle, r.releaseFunc(e, true), nil
+}
+
+// Remove
+// Unregisters the handle under `key`. The handle is closed straight away when nobody is using it, otherwise it is
+// closed when the last user releases it.
+func (r *Registry[T]) Remove(key string) error {
+	r.mu.Lock()
+	e, ok := r.entries[key]
+	if !ok {
+		r.mu.Unlock()
+		return nil
+	}
+	r.unlink(e)
+	r.mu.Unlock()
+
+	<-e.ready
+	if e.err != nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	e.removed = true
+	inUse := e.refs > 0
+	r.mu.Unlock()
+
+	if inUse {
+		return nil
+	}
+	return e.handle.Close()
+}
+
+// Has
+// Reports whether a handle is currently registered under `key`.
+func (r *Registry[T]) Has(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.entries[key]
+	return ok
+}
+
+// Len
+// Returns the number of registered handles.
+func (r *Registry[T]) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.entries)
+}
+
+// Keys
+// Returns the keys of the registered handles.
+func (r *Registry[T]) Keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]string, 0, len(r.entries))
+	for key := range r.entries {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// CloseAll
+// Closes every registered handle, whether it is in use or not, and stops idle eviction. Intended for app shutdown.
+func (r *Registry[T]) CloseAll() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	var entries []*entry[T]
+	for _, e := range r.entries {
+		entries = append(entries, e)
+	}
+	r.entries = map[string]*entry[T]{}
+	r.lru.Init()
+	r.mu.Unlock()
+
+	var errs []error
+	for _, e := range entries {
+		<-e.ready
+		if e.err != nil {
+			continue
+		}
+		if err := e.handle.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+//-----------------------------------------------------------------------------
+//-----------------------------------------------------------------------------
+
+// acquire returns the entry registered under `key` with a reference taken, opening it with `open` if it isn't open
+// yet. Pinned references keep the entry out of the handle budget.
+func (r *Registry[T]) acquire(key string, open OpenFunc[T], pin bool) (*entry[T], error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, errors.New("registry is closed")
+	}
+	e, ok := r.entries[key]
+	if ok {
+		e.refs++
+		if pin {
+			e.pins++
+		}
+		r.lru.MoveToFront(e.element)
+		r.mu.Unlock()
+
+		<-e.ready
+		if e.err != nil {
+			return nil, e.err
+		}
+		return e, nil
+	}
+
+	e = &entry[T]{key: key, ready: make(chan struct{}), refs: 1}
+	if pin {
+		e.pins = 1
+	}
+	e.element = r.lru.PushFront(e)
+	r.entries[key] = e
+	r.mu.Unlock()
+
+	handle, err := open()
+
+	r.mu.Lock()
+	e.handle = handle
+	e.err = err
+	e.lastUsed = time.Now()
+	if err != nil {
+		r.unlink(e)
+	}
+	close(e.ready)
+	r.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *Registry[T]) releaseFunc(e *entry[T], pinned bool) ReleaseFunc {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.release(e, pinned)
+		})
+	}
+}
+
+func (r *Registry[T]) release(e *entry[T], pinned bool) {
+	r.mu.Lock()
+	e.refs--
+	if pinned {
+		e.pins--
+	}
+	e.lastUsed = time.Now()
+	closeNow := e.removed && e.refs == 0
+	evicted := r.evictOverBudget()
+	r.mu.Unlock()
+
+	if closeNow {
+		_ = e.handle.Close()
+	}
+	closeEntries(evicted)
+}
+
+// unlink removes the entry from the lookup structures, must be called with the lock held.
+func (r *Registry[T]) unlink(e *entry[T]) {
+	if current, ok := r.entries[e.key]; ok && current == e {
+		delete(r.entries, e.key)
+	}
+	if e.element != nil {
+		r.lru.Remove(e.element)
+		e.element = nil
+	}
+}
+
+// evictOverBudget unlinks the least recently used idle entries until the registry is back within its handle
+// budget, must be called with the lock held. Pinned entries don't count towards the budget. The returned entries still
+// need closing.
+func (r *Registry[T]) evictOverBudget() []*entry[T] {
+	if r.maxOpen <= 0 {
+		return nil
+	}
+
+	budgeted := 0
+	for _, e := range r.entries {
+		if e.pins == 0 {
+			budgeted++
+		}
+	}
+
+	var evicted []*entry[T]
+	element := r.lru.Back()
+	for budgeted > r.maxOpen && element != nil {
+		previous := element.Prev()
+		e := element.Value.(*entry[T])
+		if e.refs == 0 && isReady(e) {
+			r.unlink(e)
+			evicted = append(evicted, e)
+			budgeted--
+		}
+		element = previous
+	}
+	return evicted
+}
+
+func (r *Registry[T]) evictIdle() {
+	// tickers panic on intervals that aren't positive, which half of a timeout of a nanosecond is
+	ticker := time.NewTicker(max(r.idleTimeout/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case now := <-ticker.C:
+			r.mu.Lock()
+			var evicted []*entry[T]
+			for _, e := range r.entries {
+				if e.refs == 0 && isReady(e) && now.Sub(e.lastUsed) > r.idleTimeout {
+					evicted = append(evicted, e)
+				}
+			}
+			for _, e := range evicted {
+				r.unlink(e)
+			}
+			r.mu.Unlock()
+
+			closeEntries(evicted)
+		}
+	}
+}
+
+func isReady[T io.Closer](e *entry[T]) bool {
+	select {
+	case <-e.ready:
+		return e.err == nil
+	default:
+		return false
+	}
+}
+
+func closeEntries[T io.Closer](entries []*entry[T]) {
+	for _, e := range entries {
+		_ = e.handle.Close()
+	}
+}
@@ -0,0 +1,191 @@
+package registry
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeHandle struct {
+	closed atomic.Int32
+}
+
+func (h *fakeHandle) Close() error {
+	h.closed.Add(1)
+	return nil
+}
+
+func openFake(handle *fakeHandle) OpenFunc[*fakeHandle] {
+	return func() (*fakeHandle, error) {
+		return handle, nil
+	}
+}
+
+func TestEvictionSkipsHandlesInUse(t *testing.T) {
+	r := New[*fakeHandle](2, 0)
+	defer r.CloseAll()
+
+	a, b, c := &fakeHandle{}, &fakeHandle{}, &fakeHandle{}
+	_, releaseA, _ := r.Acquire("a", openFake(a))
+	_, releaseB, _ := r.Acquire("b", openFake(b))
+	_, releaseC, _ := r.Acquire("c", openFake(c))
+
+	// a is the least recently used, but it is still in use
+	releaseB()
+	if b.closed.Load() != 1 {
+		t.Errorf("b closed %d times, want 1", b.closed.Load())
+	}
+	if a.closed.Load() != 0 || !r.Has("a") {
+		t.Errorf("a was evicted while in use")
+	}
+
+	releaseC()
+	if c.closed.Load() != 0 || r.Len() != 2 {
+		t.Errorf("c was evicted within the budget, %d handles open", r.Len())
+	}
+
+	releaseA()
+	if a.closed.Load() != 0 {
+		t.Errorf("a was evicted within the budget")
+	}
+}
+
+func TestPinnedHandlesOutsideBudget(t *testing.T) {
+	r := New[*fakeHandle](1, 0)
+	defer r.CloseAll()
+
+	a, b, c := &fakeHandle{}, &fakeHandle{}, &fakeHandle{}
+	_, unpinA, _ := r.Pin("a", openFake(a))
+	_, releaseB, _ := r.Acquire("b", openFake(b))
+	releaseB()
+	if b.closed.Load() != 0 {
+		t.Errorf("b was evicted within the budget, a is pinned")
+	}
+
+	// pinned handles are shared with other callers
+	got, releaseA, _ := r.Acquire("a", openFake(&fakeHandle{}))
+	if got != a {
+		t.Errorf("a was opened again while pinned")
+	}
+	releaseA()
+
+	_, releaseC, _ := r.Acquire("c", openFake(c))
+	releaseC()
+	if b.closed.Load() != 1 || c.closed.Load() != 0 {
+		t.Errorf("b closed %d times and c %d times, want 1 and 0", b.closed.Load(), c.closed.Load())
+	}
+
+	unpinA()
+	if a.closed.Load() != 1 || !r.Has("c") {
+		t.Errorf("a closed %d times once unpinned, want 1", a.closed.Load())
+	}
+}
+
+func TestRemoveClosesOnLastRelease(t *testing.T) {
+	r := New[*fakeHandle](0, 0)
+	defer r.CloseAll()
+
+	handle := &fakeHandle{}
+	_, release1, _ := r.Acquire("key", openFake(handle))
+	_, release2, _ := r.Acquire("key", openFake(&fakeHandle{}))
+
+	if err := r.Remove("key"); err != nil {
+		t.Fatalf("Remove: %s", err)
+	}
+	if r.Has("key") {
+		t.Errorf("key is still registered after Remove")
+	}
+
+	release1()
+	if handle.closed.Load() != 0 {
+		t.Errorf("handle closed while still in use")
+	}
+	release2()
+	release2()
+	if handle.closed.Load() != 1 {
+		t.Errorf("handle closed %d times, want 1", handle.closed.Load())
+	}
+
+	// a removed key opens a new handle
+	reopened := &fakeHandle{}
+	got, release, _ := r.Acquire("key", openFake(reopened))
+	defer release()
+	if got != reopened {
+		t.Errorf("Acquire after Remove returned the removed handle")
+	}
+}
+
+func TestIdleHandlesExpire(t *testing.T) {
+	r := New[*fakeHandle](0, 20*time.Millisecond)
+	defer r.CloseAll()
+
+	idle, busy := &fakeHandle{}, &fakeHandle{}
+	_, releaseIdle, _ := r.Acquire("idle", openFake(idle))
+	_, releaseBusy, _ := r.Acquire("busy", openFake(busy))
+	defer releaseBusy()
+	releaseIdle()
+
+	deadline := time.Now().Add(time.Second)
+	for r.Has("idle") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if r.Has("idle") || idle.closed.Load() != 1 {
+		t.Errorf("idle handle wasn't closed")
+	}
+	if !r.Has("busy") || busy.closed.Load() != 0 {
+		t.Errorf("handle in use expired")
+	}
+}
+
+func TestConcurrentAcquireOpensOnce(t *testing.T) {
+	r := New[*fakeHandle](0, 0)
+	defer r.CloseAll()
+
+	handle := &fakeHandle{}
+	var opened atomic.Int32
+	open := func() (*fakeHandle, error) {
+		opened.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return handle, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, release, err := r.Acquire("key", open)
+			if err != nil {
+				t.Errorf("Acquire: %s", err)
+				return
+			}
+			defer release()
+			if got != handle {
+				t.Errorf("Acquire returned a different handle")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if opened.Load() != 1 {
+		t.Errorf("opened %d times, want 1", opened.Load())
+	}
+}
+
+func TestTinyIdleTimeout(t *testing.T) {
+	r := New[*fakeHandle](0, time.Nanosecond)
+	defer r.CloseAll()
+
+	handle := &fakeHandle{}
+	_, release, _ := r.Acquire("key", openFake(handle))
+	release()
+
+	deadline := time.Now().Add(time.Second)
+	for r.Has("key") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if r.Has("key") || handle.closed.Load() != 1 {
+		t.Errorf("idle handle wasn't closed")
+	}
+}
@@ -0,0 +1,92 @@
+package statedb
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"refi/backend"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const fileName = "state.db"
+
+var (
+	stateDB *sql.DB
+	// migrated holds the statements `Migrate` already ran against `stateDB`
+	migrated  = map[string]bool{}
+	stateDBMu sync.Mutex
+)
+
+// Path
+// Location of the database holding Refi's own state (history, bookmarks, ...), kept apart from the docsets so it
+// survives docset updates.
+func Path() string {
+	return filepath.Join(backend.AppDataDir(), fileName)
+}
+
+// Open
+// Returns the shared connection to the state database, opening it on first use. Each package owning state creates its
+// own tables with `Migrate`.
+func Open() (*sql.DB, error) {
+	stateDBMu.Lock()
+	defer stateDBMu.Unlock()
+
+	if stateDB != nil {
+		return stateDB, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(Path()), 0755)
+	if err != nil {
+		return nil, err
+	}
+	dbConn, err := sql.Open("sqlite3", Path()+"?_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows a single writer, serialise access instead of failing with "database is locked"
+	dbConn.SetMaxOpenConns(1)
+
+	stateDB = dbConn
+	return stateDB, nil
+}
+
+// Migrate
+// Opens the state database and runs `statements`, which are expected to be idempotent (`CREATE TABLE IF NOT EXISTS`).
+// Statements only run once per connection.
+func Migrate(statements ...string) (*sql.DB, error) {
+	dbConn, err := Open()
+	if err != nil {
+		return nil, err
+	}
+
+	stateDBMu.Lock()
+	defer stateDBMu.Unlock()
+
+	for _, statement := range statements {
+		if migrated[statement] {
+			continue
+		}
+		if _, err = dbConn.Exec(statement); err != nil {
+			return nil, err
+		}
+		migrated[statement] = true
+	}
+	return dbConn, nil
+}
+
+// Close
+// Closes the shared connection, `Open` reopens it.
+func Close() error {
+	stateDBMu.Lock()
+	defer stateDBMu.Unlock()
+
+	if stateDB == nil {
+		return nil
+	}
+	err := stateDB.Close()
+	stateDB = nil
+	migrated = map[string]bool{}
+	return err
+}
@@ -12,7 +12,8 @@ import {
   useState,
 } from 'react';
 
-import { searchDocSet } from 'services/indexer';
+import { searchDocSet } from 'services/docsearch';
+import { recordOpen, recordQuery } from 'services/history';
 
 import { useStores } from 'stores';
 import { DocSetStore } from 'stores/DocSetStore';
@@ -63,6 +64,9 @@ const SearchResultsContainer = styled.div`
 
 export const SearchField = observer(() => {
   const indexRef = useRef<string | null>(null);
+  const queryIdRef = useRef(0);
+  // the latest query of each tab, only it clears the tab's search in progress
+  const latestQueryIdsRef = useRef(new Map<string, number>());
   const { tabsStore, docSetListStore, docSetAliasStore, errorsStore } =
     useStores();
   const searchInputRef = useRef<HTMLInputElement>(null);
@@ -145,9 +149,17 @@ export const SearchField = observer(() => {
         ) {
           tabsStore.currentTab.setQuery(event.target.value);
           tabsStore.currentTab.setSearchInProgress(true);
+          const tab = tabsStore.currentTab;
+          const queryId = ++queryIdRef.current;
+          latestQueryIdsRef.current.set(tab.id, queryId);
           let results: Awaited<ReturnType<typeof searchDocSet>> = [];
           try {
-            results = await searchDocSet(indexRef.current, event.target.value);
+            results = await searchDocSet(
+              tab.docSet?.path ?? indexRef.current,
+              event.target.value,
+              tab.id,
+              queryId,
+            );
           } catch (error) {
             console.error(
               'handleChangeSearchText => Error querying database',
@@ -155,9 +167,16 @@ export const SearchField = observer(() => {
             );
             errorsStore.addError(error as Error);
           } finally {
-            tabsStore.currentTab.setSearchInProgress(false);
+            if (latestQueryIdsRef.current.get(tab.id) === queryId) {
+              latestQueryIdsRef.current.delete(tab.id);
+              tab.setSearchInProgress(false);
+            }
+          }
+          // superseded by a newer query
+          if (results === null) {
+            return;
           }
-          tabsStore.currentTab.setSearchResults(results || []);
+          tab.setSearchResults(results || []);
         } else {
           docSetListStore.setQuery(event.target.value);
           const results = Object.values(docSetListStore.docSets).filter(
@@ -203,6 +222,19 @@ export const SearchField = observer(() => {
     }
   };
 
+  const recordOpenedSearchResult = async (result: SearchResult) => {
+    const docSet = tabsStore.currentTab?.docSet;
+    if (!docSet) {
+      return;
+    }
+    try {
+      await recordQuery(docSet.path, tabsStore.currentTab?.query ?? '');
+      await recordOpen(docSet.path, result.name, result.type, result.path);
+    } catch (error) {
+      errorsStore.addError(error as Error);
+    }
+  };
+
   const handleKeyDown: KeyboardEventHandler<HTMLInputElement> = (event) => {
     if (['ArrowUp', 'ArrowDown'].includes(event.key) && searchResultsOpen) {
       event.preventDefault();
@@ -228,6 +260,7 @@ export const SearchField = observer(() => {
       }
     } else if (event.key === 'Enter') {
       if (searchResultsOpen && tabsStore.currentTab?.selectedSearchResult) {
+        recordOpenedSearchResult(tabsStore.currentTab.selectedSearchResult);
         tabsStore.currentTab.showSelectedSearchResult();
         setSearchResultsOpen(false);
       } else if (
@@ -295,6 +328,7 @@ export const SearchField = observer(() => {
 
   const handleSelectDocSetSearchResult = (result: SearchResult) => {
     if (tabsStore.currentTab) {
+      recordOpenedSearchResult(result);
       tabsStore.currentTab.setVisibleSearchResult(result);
       setSearchResultsOpen(false);
     }
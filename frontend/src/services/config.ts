@@ -1,5 +1,17 @@
 import { LoadSettings, WriteSettings } from '../../wailsjs/go/config/Config';
 import { config } from '../../wailsjs/go/models';
+import { EventsOn } from '../../wailsjs/runtime';
+
+export interface SettingsChange {
+  key: string;
+  previous: unknown;
+  current: unknown;
+}
+
+export interface SettingsChangedEventPayload {
+  config: config.ConfigObject;
+  changes: Array<SettingsChange>;
+}
 
 export const loadSettings = async (filePath: string) => {
   const { config, error } = await LoadSettings(filePath);
@@ -18,3 +30,10 @@ export const writeSettings = async (
     throw new Error(error);
   }
 };
+
+// onSettingsChanged calls `handler` whenever the settings change after they were
+// loaded, including hand edits of the settings file. Returns a function that
+// stops listening.
+export const onSettingsChanged = (
+  handler: (payload: SettingsChangedEventPayload) => void,
+) => EventsOn('config|changed', handler);
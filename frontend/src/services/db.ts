@@ -1,10 +1,7 @@
-import { SearchResult } from 'stores/TabStore';
-
 import {
   CreateFuzzySearchIndex,
   ImportSearchIndex,
   OpenDB,
-  SearchDocSet,
   TableExists,
 } from '../../wailsjs/go/db/DB';
 
@@ -32,17 +29,6 @@ export const openDB = async (dbPath: string): Promise<void> => {
   }
 };
 
-export const searchDocSet = async (
-  dbPath: string,
-  searchTerm: string,
-): Promise<Array<SearchResult>> => {
-  const { results, error } = await SearchDocSet(dbPath, searchTerm);
-  if (error) {
-    throw new Error(error);
-  }
-  return results;
-};
-
 export const tableExists = async (
   dbPath: string,
   tableName: string,
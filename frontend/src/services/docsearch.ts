@@ -0,0 +1,32 @@
+import { SearchResult } from 'stores/TabStore';
+
+import {
+  CloseSearchTab,
+  SearchDocSet,
+} from '../../wailsjs/go/docsearch/Search';
+
+// searchDocSet resolves to null when a newer query of the tab superseded this one
+export const searchDocSet = async (
+  docSet: string,
+  term: string,
+  tabId: string,
+  queryId: number,
+): Promise<Array<SearchResult> | null> => {
+  const { results, stale, error } = await SearchDocSet(
+    tabId,
+    queryId,
+    docSet,
+    term,
+    [],
+    0,
+  );
+  if (error) {
+    throw new Error(error);
+  }
+  if (stale) {
+    return null;
+  }
+  return results;
+};
+
+export const closeSearchTab = async (tabId: string) => CloseSearchTab(tabId);
@@ -0,0 +1,20 @@
+import { RecordOpen, RecordQuery } from '../../wailsjs/go/history/History';
+
+export const recordQuery = async (docSet: string, query: string) => {
+  const error = await RecordQuery(docSet, query);
+  if (error) {
+    throw new Error(error);
+  }
+};
+
+export const recordOpen = async (
+  docSet: string,
+  name: string,
+  type: string,
+  path: string,
+) => {
+  const error = await RecordOpen(docSet, name, type, path);
+  if (error) {
+    throw new Error(error);
+  }
+};
@@ -1,7 +1,6 @@
 import {
   CloseIndex,
   CreateDocSetIndex,
-  SearchDocSet,
 } from '../../wailsjs/go/indexer/Indexer';
 
 export const closeIndex = async (indexPath: string) => {
@@ -17,11 +16,3 @@ export const createDocSetIndex = async (indexPath: string, dbPath: string) => {
     throw new Error(error);
   }
 };
-
-export const searchDocSet = async (indexPath: string, term: string) => {
-  const { results, error } = await SearchDocSet(indexPath, term);
-  if (error) {
-    throw new Error(error);
-  }
-  return results;
-};
@@ -133,8 +133,8 @@ export class DocSetManagerStore {
       runInAction(() => {
         this.updateInstallStatus(docSet.feedEntryName, 'Indexing');
       });
+      // the backend replaces the existing index, which lives outside the docset
       await closeIndex(docSet.indexPath);
-      await removeDir(docSet.indexPath);
       await createDocSetIndex(docSet.indexPath, docSet.dbPath);
     } catch (error) {
       this.errorsStore.addError(error as Error);
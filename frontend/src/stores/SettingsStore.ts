@@ -1,12 +1,17 @@
-import { action, makeObservable, observable, runInAction } from 'mobx';
+import { action, makeObservable, observable } from 'mobx';
 
-import { loadSettings, writeSettings } from 'services/config';
+import {
+  loadSettings,
+  onSettingsChanged,
+  writeSettings,
+} from 'services/config';
 import {
   doesPathExist,
   getConfigFilePath,
   getDefaultDocSetsDir,
 } from 'services/path';
 
+import { config } from '../../wailsjs/go/models';
 import { ErrorsStore } from './ErrorsStore';
 
 const DEFAULT_CONFIG = {
@@ -34,6 +39,8 @@ export class SettingsStore {
   docSetsIconsUrl = '';
   docSetsPath = '';
 
+  stopListeningForChanges: (() => void) | null = null;
+
   constructor(errorsStore: ErrorsStore) {
     this.errorsStore = errorsStore;
 
@@ -45,6 +52,7 @@ export class SettingsStore {
       docSetsPath: observable,
 
       setSelectedSettingsId: action,
+      setSettings: action,
 
       loadSettings: action,
       saveSettings: action,
@@ -63,16 +71,31 @@ export class SettingsStore {
         await writeSettings(configFilePath, { ...DEFAULT_CONFIG, docSetsPath });
       }
       const config = await loadSettings(configFilePath);
-      runInAction(() => {
-        this.docSetsFeedUrl = config.docSetsFeedUrl.toString();
-        this.docSetsIconsUrl = config.docSetsIconsUrl.toString();
-        this.docSetsPath = config.docSetsPath.toString();
-      });
+      this.setSettings(config);
+      this.listenForChanges();
     } catch (error) {
       this.errorsStore.addError(error as Error);
     }
   }
 
+  setSettings(settings: config.ConfigObject) {
+    this.docSetsFeedUrl = settings.docSetsFeedUrl.toString();
+    this.docSetsIconsUrl = settings.docSetsIconsUrl.toString();
+    this.docSetsPath = settings.docSetsPath.toString();
+  }
+
+  // listenForChanges keeps the settings up to date with changes made outside the
+  // settings screen (eg hand edits of the settings file), so saving doesn't write
+  // stale values back over them.
+  listenForChanges() {
+    if (this.stopListeningForChanges) {
+      return;
+    }
+    this.stopListeningForChanges = onSettingsChanged(({ config }) =>
+      this.setSettings(config),
+    );
+  }
+
   async saveSettings() {
     try {
       const configFilePath = await getConfigFilePath();
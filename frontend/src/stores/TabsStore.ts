@@ -1,5 +1,7 @@
 import { action, makeObservable, observable } from 'mobx';
 
+import { closeSearchTab } from 'services/docsearch';
+
 import { DocSetStore } from './DocSetStore';
 import { ErrorsStore } from './ErrorsStore';
 import { TabStore } from './TabStore';
@@ -55,6 +57,9 @@ export class TabsStore {
         this.currentTab.clearSearchResults();
         this.currentTab = null;
       }
+      closeSearchTab(this.tabs[index].id).catch((error) =>
+        this.errorsStore.addError(error as Error),
+      );
       this.tabs.splice(index, 1);
     }
   }
@@ -66,6 +71,9 @@ export class TabsStore {
         this.currentTab.clearSearchResults();
         this.currentTab = null;
       }
+      closeSearchTab(this.tabs[index].id).catch((error) =>
+        this.errorsStore.addError(error as Error),
+      );
       this.tabs.splice(index, 1);
     }
   }
@@ -18,10 +18,6 @@ export function OpenDB(arg1) {
   return window['go']['db']['DB']['OpenDB'](arg1);
 }
 
-export function SearchDocSet(arg1, arg2) {
-  return window['go']['db']['DB']['SearchDocSet'](arg1, arg2);
-}
-
 export function Startup(arg1) {
   return window['go']['db']['DB']['Startup'](arg1);
 }
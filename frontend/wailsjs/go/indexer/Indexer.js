@@ -10,10 +10,6 @@ export function CreateDocSetIndex(arg1, arg2) {
   return window['go']['indexer']['Indexer']['CreateDocSetIndex'](arg1, arg2);
 }
 
-export function SearchDocSet(arg1, arg2) {
-  return window['go']['indexer']['Indexer']['SearchDocSet'](arg1, arg2);
-}
-
 export function Startup(arg1) {
   return window['go']['indexer']['Indexer']['Startup'](arg1);
 }
@@ -51,39 +51,178 @@ export namespace config {
 
 }
 
-export namespace db {
+export namespace docsearch {
 	
-	export class DocSetRow {
+	export class Stats {
+	    engine: string;
+	    built: boolean;
+	    entries: number;
+	    sizeBytes: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Stats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.engine = source["engine"];
+	        this.built = source["built"];
+	        this.entries = source["entries"];
+	        this.sizeBytes = source["sizeBytes"];
+	    }
+	}
+	export class DocSetStatsResult {
+	    engine: string;
+	    stats: Stats[];
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DocSetStatsResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.engine = source["engine"];
+	        this.stats = this.convertValues(source["stats"], Stats);
+	        this.error = source["error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class MatchRange {
+	    start: number;
+	    end: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new MatchRange(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.start = source["start"];
+	        this.end = source["end"];
+	    }
+	}
+	export class Hit {
+	    docSetId: string;
 	    id: number;
 	    name: string;
 	    type: string;
 	    path: string;
 	    score: number;
+	    matches: MatchRange[];
+	    clause: string;
 	
 	    static createFrom(source: any = {}) {
-	        return new DocSetRow(source);
+	        return new Hit(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.docSetId = source["docSetId"];
 	        this.id = source["id"];
 	        this.name = source["name"];
 	        this.type = source["type"];
 	        this.path = source["path"];
 	        this.score = source["score"];
+	        this.matches = this.convertValues(source["matches"], MatchRange);
+	        this.clause = source["clause"];
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
-	export class SearchDocSetResult {
-	    results: DocSetRow[];
+	export class SearchResult {
+	    engine: string;
+	    results: Hit[];
+	    typeCounts: query.TypeCount[];
+	    queryId: number;
+	    stale: boolean;
 	    error: string;
 	
 	    static createFrom(source: any = {}) {
-	        return new SearchDocSetResult(source);
+	        return new SearchResult(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
-	        this.results = this.convertValues(source["results"], DocSetRow);
+	        this.engine = source["engine"];
+	        this.results = this.convertValues(source["results"], Hit);
+	        this.typeCounts = this.convertValues(source["typeCounts"], query.TypeCount);
+	        this.queryId = source["queryId"];
+	        this.stale = source["stale"];
+	        this.error = source["error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class SearchAllResult {
+	    results: Hit[];
+	    typeCounts: query.TypeCount[];
+	    docSetErrors: {[key: string]: string};
+	    queryId: number;
+	    stale: boolean;
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SearchAllResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.results = this.convertValues(source["results"], Hit);
+	        this.typeCounts = this.convertValues(source["typeCounts"], query.TypeCount);
+	        this.docSetErrors = source["docSetErrors"];
+	        this.queryId = source["queryId"];
+	        this.stale = source["stale"];
 	        this.error = source["error"];
 	    }
 	
@@ -174,37 +313,61 @@ export namespace fs {
 
 }
 
-export namespace indexer {
+export namespace history {
 	
-	export class IndexedItem {
-	    id: number;
+	export class OpenRecord {
+	    docSetId: string;
 	    name: string;
 	    type: string;
 	    path: string;
+	    count: number;
+	    lastOpened: number;
 	
 	    static createFrom(source: any = {}) {
-	        return new IndexedItem(source);
+	        return new OpenRecord(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
-	        this.id = source["id"];
+	        this.docSetId = source["docSetId"];
 	        this.name = source["name"];
 	        this.type = source["type"];
 	        this.path = source["path"];
+	        this.count = source["count"];
+	        this.lastOpened = source["lastOpened"];
+	    }
+	}
+	export class QueryRecord {
+	    docSetId: string;
+	    query: string;
+	    count: number;
+	    lastUsed: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new QueryRecord(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.docSetId = source["docSetId"];
+	        this.query = source["query"];
+	        this.count = source["count"];
+	        this.lastUsed = source["lastUsed"];
 	    }
 	}
-	export class SearchDocSetResult {
-	    results: IndexedItem[];
+	export class GetHistoryResult {
+	    queries: QueryRecord[];
+	    opens: OpenRecord[];
 	    error: string;
 	
 	    static createFrom(source: any = {}) {
-	        return new SearchDocSetResult(source);
+	        return new GetHistoryResult(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
-	        this.results = this.convertValues(source["results"], IndexedItem);
+	        this.queries = this.convertValues(source["queries"], QueryRecord);
+	        this.opens = this.convertValues(source["opens"], OpenRecord);
 	        this.error = source["error"];
 	    }
 	
@@ -229,3 +392,22 @@ export namespace indexer {
 
 }
 
+export namespace query {
+	
+	export class TypeCount {
+	    type: string;
+	    count: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TypeCount(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.type = source["type"];
+	        this.count = source["count"];
+	    }
+	}
+
+}
+
@@ -7,13 +7,22 @@ import (
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"net/http"
 	"os"
+	"path/filepath"
+	"refi/backend/annotations"
+	"refi/backend/bookmarks"
 	"refi/backend/config"
 	"refi/backend/db"
+	"refi/backend/docsearch"
 	"refi/backend/docsets"
 	"refi/backend/fs"
+	"refi/backend/health"
+	"refi/backend/history"
 	"refi/backend/indexer"
+	"refi/backend/statedb"
+	"strings"
 )
 
 //go:embed all:frontend/dist
@@ -21,32 +30,70 @@ var assets embed.FS
 
 type FileLoader struct {
 	http.Handler
+	ctx context.Context
 }
 
 func NewFileLoader() *FileLoader {
 	return &FileLoader{}
 }
 
+func (h *FileLoader) Startup(ctx context.Context) {
+	h.ctx = ctx
+}
+
 func (h *FileLoader) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	var err error
 	requestedFilename := req.URL.Path
-	fmt.Printf("***** [ Serving %s\n", requestedFilename)
+	runtime.LogDebugf(h.ctx, "ServeHTTP: Serving \"%s\"", requestedFilename)
+
+	// search result paths may carry Dash metadata or url encoding, and might only exist online
+	var pageAnnotations []annotations.Annotation
+	if docSet, err := docsets.FromPath(requestedFilename); err == nil {
+		resolved := docSet.ResolveDocumentFile(requestedFilename)
+		if !resolved.Exists && resolved.FallbackUrl != "" {
+			http.Redirect(res, req, resolved.FallbackUrl, http.StatusFound)
+			return
+		}
+		if resolved.DocumentPath != "" {
+			requestedFilename = resolved.DocumentPath
+		}
+		if resolved.Exists && isHTMLFile(requestedFilename) {
+			pageAnnotations, err = annotations.ForPage(docSet.Id, resolved.RelativePath)
+			if err != nil {
+				runtime.LogErrorf(h.ctx, "ServeHTTP: Error loading annotations for \"%s\"\n%s", requestedFilename, err)
+			}
+		}
+	}
+
 	fileData, err := os.ReadFile(requestedFilename)
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
+		res.WriteHeader(http.StatusNotFound)
 		res.Write([]byte(fmt.Sprintf("Could not load file %s", requestedFilename)))
+		return
 	}
+	fileData = annotations.InjectMarkers(fileData, pageAnnotations)
 
 	res.Write(fileData)
 }
 
+func isHTMLFile(filename string) bool {
+	extension := strings.ToLower(filepath.Ext(filename))
+	return extension == ".html" || extension == ".htm"
+}
+
 func main() {
 	app := NewApp()
+	beAnnotations := annotations.NewAnnotations()
+	beBookmarks := bookmarks.NewBookmarks()
 	beConfig := config.NewConfig()
 	beDB := db.NewDB()
 	beDocSets := docsets.NewDocSets()
 	beFS := fs.NewFS()
+	beHistory := history.NewHistory()
 	beIndex := indexer.NewIndexer()
+	beHealth := health.NewHealth(beDB, beIndex)
+	beSearch := docsearch.NewSearch(db.NewLikeBackend(beDB), indexer.NewBleveBackend(beIndex))
+	fileLoader := NewFileLoader()
 
 	err := wails.Run(&options.App{
 		Title:             "Refi",
@@ -55,24 +102,43 @@ func main() {
 		HideWindowOnClose: true,
 		AssetServer: &assetserver.Options{
 			Assets:  assets,
-			Handler: NewFileLoader(),
+			Handler: fileLoader,
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup: func(ctx context.Context) {
 			app.startup(ctx)
+			fileLoader.Startup(ctx)
+			beAnnotations.Startup(ctx)
+			beBookmarks.Startup(ctx)
 			beConfig.Startup(ctx)
 			beDB.Startup(ctx)
 			beDocSets.Startup(ctx)
 			beFS.Startup(ctx)
+			beHealth.Startup(ctx)
+			beHistory.Startup(ctx)
 			beIndex.Startup(ctx)
+			beSearch.Startup(ctx)
+		},
+		OnShutdown: func(ctx context.Context) {
+			beConfig.Shutdown(ctx)
+			beDB.Shutdown(ctx)
+			beIndex.Shutdown(ctx)
+			if err := statedb.Close(); err != nil {
+				runtime.LogErrorf(ctx, "OnShutdown: Error closing state db \"%s\"\n%s", statedb.Path(), err)
+			}
 		},
 		Bind: []interface{}{
 			app,
+			beAnnotations,
+			beBookmarks,
 			beConfig,
 			beDB,
 			beDocSets,
 			beFS,
+			beHealth,
+			beHistory,
 			beIndex,
+			beSearch,
 		},
 	})
 